@@ -1,5 +1,6 @@
 const ACTION_STATUS = 0;
 const ACTION_RESULT = 1;
+const ACTION_EXPORT = 2;
 
 /**
  * @typedef {Object} Language
@@ -9,6 +10,74 @@ const ACTION_RESULT = 1;
  * @property {number} lines
  * @property {number} files
  * @property {string} badge_url
+ * @property {"programming" | "markup" | "data" | "prose" | ""} type
+ * @property {string} color hex color like #00ADD8, empty if unknown
+ * @property {LanguageRole[]} roles
+ */
+
+/**
+ * @typedef {Object} LanguageRole
+ * @property {"test" | "example" | "documentation" | "build" | "production"} role
+ * @property {number} files
+ * @property {number} lines
+ * @property {number} blank
+ * @property {number} comments
+ */
+
+/**
+ * @typedef {Object} FragmentLocation
+ * @property {string} path
+ * @property {number} start_line
+ * @property {number} end_line
+ */
+
+/**
+ * @typedef {Object} Fragment
+ * @property {string} language
+ * @property {number} lines
+ * @property {FragmentLocation[]} locations
+ */
+
+/**
+ * @typedef {Object} Duplication
+ * @property {number} code_lines
+ * @property {number} duplicated_lines
+ * @property {{name: string, code_lines: number, duplicated_lines: number}[]} languages
+ * @property {Fragment[]} fragments
+ */
+
+/**
+ * @typedef {Object} MarkerOccurrence
+ * @property {string} tag
+ * @property {string} language
+ * @property {string} path
+ * @property {number} line
+ * @property {string} text
+ */
+
+/**
+ * @typedef {Object} Markers
+ * @property {string[]} tags
+ * @property {number} total
+ * @property {Object<string, number>} counts
+ * @property {{name: string, total: number, counts: Object<string, number>}[]} languages
+ * @property {MarkerOccurrence[]} occurrences
+ * @property {boolean} truncated
+ */
+
+/**
+ * @typedef {Object} License
+ * @property {string} primary
+ * @property {number} confidence
+ * @property {{path: string, license: string, confidence: number}[]} files
+ * @property {{license: string, files: number}[]} headers
+ */
+
+/**
+ * @typedef {Object} Ecosystem
+ * @property {string} name
+ * @property {string[]} manifests
+ * @property {{name: string, version: string, manifest: string, dev: boolean}[]} dependencies
  */
 
 /**
@@ -16,6 +85,9 @@ const ACTION_RESULT = 1;
  * @property {number} repo_size_limit
  * @property {boolean} parallel_mode
  * @property {Language[]} languages
+ * @property {Ecosystem[]} dependencies
+ * @property {LanguageRole[]} roles
+ * @property {number} test_ratio
  * @property {number} total_lines
  * @property {number} total_files
  * @property {number} total_blank
@@ -25,6 +97,12 @@ const ACTION_RESULT = 1;
  * @property {string} fetch_speed_str
  * @property {string} analysis_speed_str
  * @property {string} error
+ * @property {Duplication | null} duplication
+ * @property {Markers | null} markers
+ * @property {License} license
+ * @property {string} ref analyzed branch, tag or commit
+ * @property {string} commit SHA of the analyzed commit
+ * @property {string} task_id empty for cached results
  */
 
 /**
@@ -33,6 +111,9 @@ const ACTION_RESULT = 1;
  *	@property {string} id
  *	@property {boolean} error
  *	@property {string} error_message
+ *	@property {number} position position in the queue, 0 if not queued
+ *	@property {number} ahead queued tasks ahead
+ *	@property {number} estimated_wait seconds until the task is done
  */
 
 /**
@@ -42,6 +123,10 @@ const ACTION_RESULT = 1;
  * @property {boolean} task_done
  * @property {boolean} task_error
  * @property {string} task_error_message
+ * @property {"network" | "auth" | "not_found" | "empty" | "too_large" | "canceled" | "expired" | "internal" | "unexpected" | "timeout" | "forbidden" | ""} task_error_code
+ * @property {number} task_position position in the queue, 0 if not queued
+ * @property {number} task_ahead queued tasks ahead
+ * @property {number} task_estimated_wait seconds until the task is done
  * @property {TaskResult}  task_result
  */
 
@@ -86,6 +171,21 @@ class Client {
     }).then((response) => response.json());
   }
 
+  /**
+   * DELETE "/task/:id", the request outlives the page
+   * @param {string} taskID
+   * @returns {Promise<TaskStatusResponse>}
+   */
+  cancelTask(taskID) {
+    return fetch(`/api/task/${taskID}`, {
+      method: "DELETE",
+      keepalive: true,
+      headers: {
+        Accept: "application/json",
+      }
+    }).then((response) => response.json());
+  }
+
   /**
    *	@param {taskID} string
    *	@param {"application/json" | "text/html"} acceptType
@@ -99,6 +199,15 @@ class Client {
       }
     }).then((response) => acceptType.includes("text/html") ? response.text() : response.json());
   }
+
+  /**
+   * GET "/task/:id/2", the markers of the result as a CSV file
+   * @param {string} taskID
+   * @returns {string}
+   */
+  markersExportURL(taskID) {
+    return `/api/task/${taskID}/${ACTION_EXPORT}`;
+  }
 }
 
 export const client = new Client();
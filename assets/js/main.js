@@ -1,9 +1,31 @@
 import { client } from "./client.js";
 
+// task states, STATUS_DONE and above are final
 const STATUS_INIT = 1;
 const STATUS_FETCHING = 2;
 const STATUS_ANALYZING = 3;
 const STATUS_DONE = 4;
+const STATUS_CANCELED = 5;
+const STATUS_FAILED = 6;
+const STATUS_EXPIRED = 7;
+// messages by task error code, the server message is shown for other codes
+const TASK_ERROR_MESSAGES = {
+  network: "Could not reach the repository host, please try again later.",
+  auth: "The repository is private or requires authentication.",
+  not_found: "The repository was not found.",
+  empty: "The repository is empty.",
+  too_large: "The repository is too large to be analyzed right now.",
+  canceled: "The analysis was canceled.",
+  expired: "The analysis was canceled because the page stopped waiting for it.",
+  forbidden: "The repository host is not allowed.",
+};
+
+/**
+ * @param {Partial<import("./client.js").TaskStatusResponse>} data
+ * @returns {string}
+ */
+const taskErrorMessage = (data) => TASK_ERROR_MESSAGES[data.task_error_code] || data.task_error_message;
+
 /**
 
  * @param {number} ms
@@ -30,6 +52,8 @@ class App {
 
   #taskID = "";
 
+  #taskRunning = false;
+
   /** @type {AnalyzeForm} */
   #form = null;
 
@@ -47,6 +71,19 @@ class App {
     this.#form = new AnalyzeForm({
       onSubmit: (e) => this.createTask(e),
     });
+
+    // nobody waits for the result after the page is closed
+    window.addEventListener("pagehide", () => this.cancelTask());
+  }
+
+  cancelTask() {
+    if (!this.#taskRunning) {
+      return;
+    }
+
+    this.#taskRunning = false;
+    clearInterval(this.#fetchStatusInterval);
+    client.cancelTask(this.#taskID);
   }
 
   get resLayout() {
@@ -99,6 +136,7 @@ class App {
 
       this.#hasAccess = false;
       this.taskId = data.id;
+      this.#taskRunning = true;
       this.getTaskStatus();
       this.#fetchStatusInterval = setInterval(() => this.getTaskStatus(), 300);
     };
@@ -114,8 +152,11 @@ class App {
      *	@property {string} repo_owner
      *	@property {string} repo_name
      *	@property {string} repo_url
+     *	@property {string} ref branch, tag or commit, the default branch if empty
+     *	@property {string} access_token access token for a private repository, it is not stored
      *	@property {Array<string>} exclude_file_patterns
      *	@property {Array<string>} exclude_dir_patterns
+     *	@property {string} languages custom language definitions in JSON
      *	@property {TypeFnGet} get
      */
 
@@ -162,15 +203,16 @@ class App {
      * @returns {void}
      */
     const handleData = (data) => {
-      this.#resLayout.renderStatus(data.task_status);
+      this.#resLayout.renderStatus(data.task_status, data.task_position, data.task_estimated_wait);
 
       if (data.task_done) {
         clearInterval(this.#fetchStatusInterval);
+        this.#taskRunning = false;
 
         if (data.task_error) {
           this.#form.disable = false;
           this.#hasAccess = false;
-          this.#resLayout.renderError(data.task_error_message);
+          this.#resLayout.renderError(taskErrorMessage(data));
           return;
         }
 
@@ -181,6 +223,7 @@ class App {
     const handleException = () => {
       this.#resLayout.renderError("INTERNAL_ERROR");
       clearInterval(this.#fetchStatusInterval);
+      this.#taskRunning = false;
     };
 
     return client.getTaskStatus(this.#taskID).then(handleData).catch(handleException);
@@ -197,7 +240,7 @@ class App {
       if (data.task_error) {
         this.#form.disable = false;
         this.#hasAccess = false;
-        this.#resLayout.renderError(data.task_error_message);
+        this.#resLayout.renderError(taskErrorMessage(data));
         return;
       }
 
@@ -353,20 +396,33 @@ class ResponseLayout {
 
   /**
    * @param {number | undefined} status
+   * @param {number | undefined} position position in the queue, 0 if not queued
+   * @param {number | undefined} wait estimated seconds until the task is done
    * @returns {void}
    */
-  renderStatus(status) {
+  renderStatus(status, position, wait) {
     this.#error.addClass("hidden");
     $("#form").addClass("hidden");
 
-    const message =
+    let message =
       {
-        1: "Sending...",
-        2: "Fetching Repository...",
-        3: "Analyzing Repository...",
-        4: "Done.",
+        [STATUS_INIT]: "Sending...",
+        [STATUS_FETCHING]: "Fetching Repository...",
+        [STATUS_ANALYZING]: "Analyzing Repository...",
+        [STATUS_DONE]: "Done.",
+        [STATUS_CANCELED]: "Canceled.",
+        [STATUS_FAILED]: "Failed.",
+        [STATUS_EXPIRED]: "Expired.",
       }[status] || "Loading...";
 
+    if (position > 0) {
+      message = `Queued: ${position - 1} ahead...`;
+    }
+
+    if (wait > 0 && status < STATUS_DONE) {
+      message += ` about ${Math.ceil(wait)}s left`;
+    }
+
     if (!this.#elem.find("#status-bar").length) {
       this.#elem.html(`
 			<div id="status-bar" class="status">
@@ -399,6 +455,133 @@ class ResponseLayout {
       });
   }
 
+  /**
+   *	@param {import("./client.js").Ecosystem[] | null} ecosystems
+   *	@returns {JQuery<HTMLDivElement> | null}
+   */
+  renderDependencies(ecosystems) {
+    if (!ecosystems || !ecosystems.length) {
+      return null;
+    }
+
+    let rows = ecosystems.flatMap((ecosystem) =>
+      ecosystem.dependencies.map((dep) =>
+        $("<tr>").append(
+          $("<td>").text(ecosystem.name),
+          $("<td>").text(dep.dev ? `${dep.name} (dev)` : dep.name),
+          $("<td>").text(dep.version),
+          $("<td>").append($("<code>").text(dep.manifest)),
+        ),
+      ),
+    );
+
+    let table = $("<table>")
+      .addClass("repo-table")
+      .append("<thead><tr><th>Ecosystem</th><th>Name</th><th>Version</th><th>Manifest</th></tr></thead>")
+      .append($("<tbody>").append(rows));
+
+    return $("<div>")
+      .addClass("section")
+      .append($("<h3>").addClass("section-title").text("Dependencies"), table);
+  }
+
+  /**
+   *	@param {import("./client.js").Duplication | null} duplication
+   *	@returns {JQuery<HTMLDivElement> | null}
+   */
+  renderDuplication(duplication) {
+    if (!duplication) {
+      return null;
+    }
+
+    let rows = duplication.languages.map(
+      (lang) => `<tr>
+					<td>${lang.name}</td>
+					<td>${lang.code_lines}</td>
+					<td>${lang.duplicated_lines}</td>
+					</tr>`,
+    );
+
+    rows.push(`<tr>
+					<td>TOTAL</td>
+					<td>${duplication.code_lines}</td>
+					<td>${duplication.duplicated_lines}</td>
+					</tr>`);
+
+    let table = $("<table>")
+      .addClass("repo-table")
+      .append("<thead><tr><th>Language</th><th>Code Lines</th><th>Duplicated Lines</th></tr></thead>")
+      .append($("<tbody>").append(rows));
+
+    let fragments = $("<ul>")
+      .addClass("section-list")
+      .append(
+        duplication.fragments.map((fragment) =>
+          $("<li>")
+            .append($("<strong>").text(`${fragment.lines} lines`))
+            .append(` of ${fragment.language}: `)
+            .append(
+              fragment.locations.map((loc) => $("<code>").text(`${loc.path}:${loc.start_line}-${loc.end_line} `)),
+            ),
+        ),
+      );
+
+    return $("<div>")
+      .addClass("section")
+      .append($("<h3>").addClass("section-title").text("Duplication"), table, fragments);
+  }
+
+  /**
+   *	@param {import("./client.js").Markers | null} markers
+   *	@param {string} taskID empty for cached results, they can not be exported
+   *	@returns {JQuery<HTMLDivElement> | null}
+   */
+  renderMarkers(markers, taskID) {
+    if (!markers) {
+      return null;
+    }
+
+    let head = ["Language", ...markers.tags, "Total"].map((text) => $("<th>").text(text));
+
+    let rows = markers.languages.map((lang) =>
+      $("<tr>").append(
+        $("<td>").text(lang.name),
+        markers.tags.map((tag) => $("<td>").text(lang.counts[tag] || 0)),
+        $("<td>").text(lang.total),
+      ),
+    );
+
+    rows.push(
+      $("<tr>").append(
+        $("<td>").text("TOTAL"),
+        markers.tags.map((tag) => $("<td>").text(markers.counts[tag] || 0)),
+        $("<td>").text(markers.total),
+      ),
+    );
+
+    let table = $("<table>")
+      .addClass("repo-table")
+      .append($("<thead>").append($("<tr>").append(head)), $("<tbody>").append(rows));
+
+    let occurrences = $("<ul>")
+      .addClass("section-list")
+      .append(
+        markers.occurrences.map((occ) =>
+          $("<li>")
+            .append($("<strong>").text(occ.tag), " ", $("<code>").text(`${occ.path}:${occ.line}`), " ")
+            .append(document.createTextNode(occ.text)),
+        ),
+      );
+
+    let download = taskID
+      ? $("<a>").attr("href", client.markersExportURL(taskID)).attr("download", "").text("Download CSV")
+      : null;
+
+    return $("<div>")
+      .addClass("section")
+      .append($("<h3>").addClass("section-title").text("Markers"), download, table, occurrences);
+  }
+
   /**
    *	@param {import("./client.js").TaskResult} data
    *	@returns {Promise<void>}
@@ -414,7 +597,13 @@ class ResponseLayout {
           .addClass("metadata")
           .append(`<p>Fetch Speed: <strong>${data.fetch_speed_str || "unknown"}</strong></p>`)
           .append(`<p>Analysis Speed: <strong>${data.analysis_speed_str || "unknown"}</strong></p>`)
-          .append(`<p>Parallel Mode: <strong>${data.parallel_mode ? "yes" : "no"}</strong></p>`);
+          .append(`<p>Parallel Mode: <strong>${data.parallel_mode ? "yes" : "no"}</strong></p>`)
+          .append(`<p>Test / Code: <strong>${(data.test_ratio || 0).toFixed(2)}</strong></p>`)
+          .append(
+            $("<p>")
+              .append("License: ")
+              .append($("<strong>").text((data.license && data.license.primary) || "unknown")),
+          );
 
         let theadItems = [
           { text: "Language" },
@@ -492,7 +681,17 @@ class ResponseLayout {
 
         let table = $("<table>").addClass("repo-table").attr("id", "repo-table").append(thead, tbody);
 
-        this.#elem.html($(`<div>`).addClass("main").append(metadata, table));
+        this.#elem.html(
+          $(`<div>`)
+            .addClass("main")
+            .append(
+              metadata,
+              table,
+              this.renderDependencies(data.dependencies),
+              this.renderDuplication(data.duplication),
+              this.renderMarkers(data.markers, data.task_id),
+            ),
+        );
         $("#form").removeClass("hidden");
       })
       .then(() => $("html").animate({ scrollTop: $("#repo-table").offset().top }, 350));
@@ -0,0 +1,345 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ECOSYSTEM_GO    = "Go"
+	ECOSYSTEM_NPM   = "npm"
+	ECOSYSTEM_PYPI  = "PyPI"
+	ECOSYSTEM_CARGO = "Cargo"
+
+	MANIFEST_MAX_SIZE = 1024 * 1024 // manifests bigger than 1MB are skipped
+)
+
+type Dependency struct {
+	Name     string `json:"name" redis:"name"`
+	Version  string `json:"version" redis:"version"`   // declared version or version constraint
+	Manifest string `json:"manifest" redis:"manifest"` // path of the manifest relative to the repository
+	Dev      bool   `json:"dev" redis:"dev"`           // development only dependency
+}
+
+type Ecosystem struct {
+	Name         string        `json:"name" redis:"name"`
+	Manifests    []string      `json:"manifests" redis:"manifests"`
+	Dependencies []*Dependency `json:"dependencies" redis:"dependencies"`
+}
+
+type manifestParser struct {
+	ecosystem string
+	parse     func(content []byte) ([]*Dependency, error)
+}
+
+var manifestParsers = map[string]*manifestParser{
+	"go.mod":           {ECOSYSTEM_GO, parseGoMod},
+	"package.json":     {ECOSYSTEM_NPM, parsePackageJSON},
+	"requirements.txt": {ECOSYSTEM_PYPI, parseRequirements},
+	"Cargo.toml":       {ECOSYSTEM_CARGO, parseCargoToml},
+}
+
+// returns parser for the manifest file name, requirements files
+// are often split by environment like requirements-dev.txt
+func manifestParserFor(name string) (*manifestParser, bool) {
+	if parser, ok := manifestParsers[name]; ok {
+		return parser, true
+	}
+
+	if strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt") {
+		return manifestParsers["requirements.txt"], true
+	}
+
+	return nil, false
+}
+
+// DependencyScanner parses dependency manifests found during the repository walk
+type DependencyScanner struct {
+	mu         sync.Mutex
+	ecosystems map[string]*Ecosystem
+}
+
+func NewDependencyScanner() *DependencyScanner {
+	return &DependencyScanner{
+		ecosystems: make(map[string]*Ecosystem),
+	}
+}
+
+// parse the file if it is a known manifest, rel is the path reported in the result
+func (d *DependencyScanner) Scan(path, rel string) {
+	parser, ok := manifestParserFor(filepath.Base(path))
+
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil || info.Size() > MANIFEST_MAX_SIZE {
+		return
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	deps, err := parser.parse(content)
+
+	// broken manifests are ignored, they are still counted as regular files
+	if err != nil {
+		return
+	}
+
+	for _, dep := range deps {
+		dep.Manifest = rel
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ecosystem, ok := d.ecosystems[parser.ecosystem]
+
+	if !ok {
+		ecosystem = &Ecosystem{
+			Name:         parser.ecosystem,
+			Manifests:    make([]string, 0),
+			Dependencies: make([]*Dependency, 0),
+		}
+		d.ecosystems[parser.ecosystem] = ecosystem
+	}
+
+	ecosystem.Manifests = append(ecosystem.Manifests, rel)
+	ecosystem.Dependencies = append(ecosystem.Dependencies, deps...)
+}
+
+func (d *DependencyScanner) Result() []*Ecosystem {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]*Ecosystem, 0, len(d.ecosystems))
+
+	for _, ecosystem := range d.ecosystems {
+		sort.Strings(ecosystem.Manifests)
+		sort.SliceStable(ecosystem.Dependencies, func(i, j int) bool {
+			dep1, dep2 := ecosystem.Dependencies[i], ecosystem.Dependencies[j]
+
+			if dep1.Name == dep2.Name {
+				return dep1.Manifest < dep2.Manifest
+			}
+
+			return dep1.Name < dep2.Name
+		})
+
+		result = append(result, ecosystem)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// go.mod: direct requirements only, "// indirect" ones are skipped
+func parseGoMod(content []byte) ([]*Dependency, error) {
+	deps := make([]*Dependency, 0)
+	inRequire := false
+	s := bufio.NewScanner(bytes.NewReader(content))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case line == "require (":
+			inRequire = true
+			continue
+		case inRequire && line == ")":
+			inRequire = false
+			continue
+		case strings.HasPrefix(line, "require "):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "require"))
+		case !inRequire:
+			continue
+		}
+
+		if strings.HasSuffix(line, "// indirect") {
+			continue
+		}
+
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		deps = append(deps, &Dependency{Name: fields[0], Version: fields[1]})
+	}
+
+	return deps, s.Err()
+}
+
+func parsePackageJSON(content []byte) ([]*Dependency, error) {
+	pkg := struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}{}
+
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return nil, err
+	}
+
+	deps := make([]*Dependency, 0, len(pkg.Dependencies)+len(pkg.DevDependencies))
+
+	for name, version := range pkg.Dependencies {
+		deps = append(deps, &Dependency{Name: name, Version: version})
+	}
+
+	for name, version := range pkg.DevDependencies {
+		deps = append(deps, &Dependency{Name: name, Version: version, Dev: true})
+	}
+
+	return deps, nil
+}
+
+var requirementRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*(.*)$`)
+
+// requirements.txt: options like "-r other.txt" and urls are skipped,
+// version is the declared specifier like "==1.0.0" or ">=2.1"
+func parseRequirements(content []byte) ([]*Dependency, error) {
+	deps := make([]*Dependency, 0)
+	s := bufio.NewScanner(bytes.NewReader(content))
+
+	for s.Scan() {
+		line := s.Text()
+
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		// environment markers: requests>=2.0; python_version < "3.8"
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+
+		matches := requirementRegexp.FindStringSubmatch(line)
+
+		if matches == nil {
+			continue
+		}
+
+		deps = append(deps, &Dependency{
+			Name:    matches[1],
+			Version: strings.ReplaceAll(matches[3], " ", ""),
+		})
+	}
+
+	return deps, s.Err()
+}
+
+var (
+	tomlKeyValueRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+)(\.workspace)?\s*=\s*(.*)$`)
+	tomlVersionRegexp  = regexp.MustCompile(`version\s*=\s*"([^"]*)"`)
+)
+
+// Cargo.toml: [dependencies], [dev-dependencies], [build-dependencies]
+// and their target specific variants, both inline and table forms are supported.
+// Only dev-dependencies are development ones, build scripts are part of the build.
+// [workspace.dependencies] are left out, they are shared versions the members inherit
+// and the members list the ones they use
+func parseCargoToml(content []byte) ([]*Dependency, error) {
+	deps := make([]*Dependency, 0)
+	s := bufio.NewScanner(bytes.NewReader(content))
+
+	var (
+		inDeps bool
+		dev    bool
+		table  *Dependency // [dependencies.name] table
+	)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			section := strings.Trim(line, "[] ")
+			table = nil
+			inDeps = false
+			parts := strings.Split(section, ".")
+
+			if parts[0] == "workspace" {
+				continue
+			}
+
+			for i, part := range parts {
+				if !strings.HasSuffix(part, "dependencies") {
+					continue
+				}
+
+				dev = part == "dev-dependencies" || part == "dev_dependencies"
+
+				if i == len(parts)-1 {
+					inDeps = true
+				} else if i == len(parts)-2 {
+					table = &Dependency{Name: parts[i+1], Dev: dev}
+					deps = append(deps, table)
+				}
+
+				break
+			}
+
+			continue
+		}
+
+		if table != nil {
+			if matches := tomlVersionRegexp.FindStringSubmatch(line); matches != nil && strings.HasPrefix(line, "version") {
+				table.Version = matches[1]
+			}
+			continue
+		}
+
+		if !inDeps {
+			continue
+		}
+
+		matches := tomlKeyValueRegexp.FindStringSubmatch(line)
+
+		if matches == nil {
+			continue
+		}
+
+		dep := &Dependency{Name: matches[1], Dev: dev}
+		value := matches[3]
+
+		if strings.HasPrefix(value, "\"") {
+			dep.Version = strings.SplitN(value[1:], "\"", 2)[0]
+		} else if version := tomlVersionRegexp.FindStringSubmatch(value); version != nil {
+			dep.Version = version[1]
+		}
+
+		deps = append(deps, dep)
+	}
+
+	return deps, s.Err()
+}
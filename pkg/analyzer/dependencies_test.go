@@ -0,0 +1,167 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func depsToMap(deps []*Dependency) map[string]string {
+	m := make(map[string]string)
+
+	for _, dep := range deps {
+		name := dep.Name
+
+		if dep.Dev {
+			name += " (dev)"
+		}
+
+		m[name] = dep.Version
+	}
+
+	return m
+}
+
+func TestParseManifests(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func([]byte) ([]*Dependency, error)
+		content string
+		want    map[string]string
+	}{
+		{
+			"go.mod",
+			parseGoMod,
+			`module example.com/app
+
+go 1.22
+
+require github.com/single/dep v1.0.0
+
+require (
+	github.com/gin-gonic/gin v1.10.0
+	github.com/google/uuid v1.6.0 // pinned
+	golang.org/x/sys v0.20.0 // indirect
+)`,
+			map[string]string{
+				"github.com/single/dep":    "v1.0.0",
+				"github.com/gin-gonic/gin": "v1.10.0",
+				"github.com/google/uuid":   "v1.6.0",
+			},
+		},
+		{
+			"package.json",
+			parsePackageJSON,
+			`{"name": "app", "dependencies": {"react": "^18.2.0"}, "devDependencies": {"jest": "~29.0.0"}}`,
+			map[string]string{
+				"react":      "^18.2.0",
+				"jest (dev)": "~29.0.0",
+			},
+		},
+		{
+			"requirements.txt",
+			parseRequirements,
+			`# web
+-r base.txt
+Django==4.2.1
+requests[security] >= 2.0 ; python_version < "3.8"
+numpy
+git+https://github.com/owner/repo.git`,
+			map[string]string{
+				"Django":   "==4.2.1",
+				"requests": ">=2.0",
+				"numpy":    "",
+			},
+		},
+		{
+			"Cargo.toml",
+			parseCargoToml,
+			`[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+anyhow = "1" # errors
+local = { path = "../local" }
+
+[dependencies.tokio]
+version = "1.38"
+features = ["full"]
+
+[target.'cfg(unix)'.dependencies]
+libc = "0.2"
+
+[build-dependencies]
+cc = "1.0"
+
+[target.'cfg(windows)'.build-dependencies]
+winres = "0.1"
+
+[workspace.dependencies]
+regex = "1.10"
+
+[workspace.dependencies.rand]
+version = "0.8"
+
+[dev-dependencies]
+criterion = "0.5"`,
+			map[string]string{
+				"serde":           "1.0",
+				"anyhow":          "1",
+				"local":           "",
+				"tokio":           "1.38",
+				"libc":            "0.2",
+				"cc":              "1.0",
+				"winres":          "0.1",
+				"criterion (dev)": "0.5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := tt.parse([]byte(tt.content))
+
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			if got := depsToMap(deps); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeDependencies(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "web"), 0755)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n\nrequire github.com/google/uuid v1.6.0\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "web", "package.json"), []byte(`{"dependencies": {"react": "^18.2.0"}}`), 0644)
+
+	analyzer := New(&Options{})
+	result, _, _ := analyzer.Do(dir, false)
+
+	names := make([]string, 0)
+
+	for _, ecosystem := range result.Dependencies {
+		names = append(names, ecosystem.Name)
+	}
+
+	sort.Strings(names)
+
+	if !reflect.DeepEqual(names, []string{ECOSYSTEM_GO, ECOSYSTEM_NPM}) {
+		t.Fatalf("Unexpected ecosystems %v", names)
+	}
+
+	npm := result.Dependencies[1]
+
+	if npm.Manifests[0] != "web/package.json" || npm.Dependencies[0].Manifest != "web/package.json" {
+		t.Errorf("Unexpected manifest path %v", npm.Manifests)
+	}
+}
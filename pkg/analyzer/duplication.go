@@ -0,0 +1,283 @@
+package analyzer
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	DUPLICATION_WINDOW    = 6  // number of consecutive code lines hashed as one block
+	DUPLICATION_FRAGMENTS = 10 // max number of reported duplicated fragments
+)
+
+type FragmentLocation struct {
+	Path      string `json:"path" redis:"path"`
+	StartLine int    `json:"start_line" redis:"start_line"`
+	EndLine   int    `json:"end_line" redis:"end_line"`
+}
+
+// Fragment is a block of code lines repeated in several places of the repository
+type Fragment struct {
+	Language  string              `json:"language" redis:"language"`
+	Lines     int                 `json:"lines" redis:"lines"` // code lines in one copy of the fragment
+	Locations []*FragmentLocation `json:"locations" redis:"locations"`
+}
+
+type LanguageDuplication struct {
+	Name            string `json:"name" redis:"name"`
+	CodeLines       int32  `json:"code_lines" redis:"code_lines"`
+	DuplicatedLines int32  `json:"duplicated_lines" redis:"duplicated_lines"`
+}
+
+type Duplication struct {
+	CodeLines       int32                  `json:"code_lines" redis:"code_lines"`
+	DuplicatedLines int32                  `json:"duplicated_lines" redis:"duplicated_lines"`
+	Languages       []*LanguageDuplication `json:"languages" redis:"languages"`
+	Fragments       []*Fragment            `json:"fragments" redis:"fragments"`
+}
+
+type codeLine struct {
+	number int    // line number in the source file
+	hash   uint64 // hash of the normalized line
+}
+
+type dupFile struct {
+	path  string
+	lang  string
+	lines []codeLine
+	dup   []bool // marks duplicated code lines
+}
+
+type windowLoc struct {
+	file int
+	idx  int // index of the first code line of the window
+}
+
+// DuplicationDetector collects normalized code lines of every analyzed file
+// and finds blocks of DUPLICATION_WINDOW lines that occur more than once.
+// Files are added concurrently by file workers, so Add is guarded by a mutex.
+type DuplicationDetector struct {
+	mu     sync.Mutex
+	window int
+	files  []*dupFile
+}
+
+func NewDuplicationDetector() *DuplicationDetector {
+	return &DuplicationDetector{
+		window: DUPLICATION_WINDOW,
+		files:  make([]*dupFile, 0),
+	}
+}
+
+// hash line without whitespace, lines without any letter or digit
+// like "}" or "});" are too common to be meaningful and are skipped
+func hashCodeLine(line string) (uint64, bool) {
+	var normalized strings.Builder
+	meaningful := false
+
+	for _, r := range line {
+		if unicode.IsSpace(r) {
+			continue
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			meaningful = true
+		}
+
+		normalized.WriteRune(r)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(normalized.String()))
+
+	return h.Sum64(), meaningful
+}
+
+func (d *DuplicationDetector) Add(path, lang string, lines []codeLine) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.files = append(d.files, &dupFile{
+		path:  path,
+		lang:  lang,
+		lines: lines,
+		dup:   make([]bool, len(lines)),
+	})
+}
+
+func (d *DuplicationDetector) windowHash(lines []codeLine) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+
+	for _, line := range lines {
+		for i := range buf {
+			buf[i] = byte(line.hash >> (8 * i))
+		}
+		h.Write(buf)
+	}
+
+	return h.Sum64()
+}
+
+func (d *DuplicationDetector) Result() *Duplication {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the order of files depends on file workers, sort them to get a stable result
+	sort.Slice(d.files, func(i, j int) bool {
+		return d.files[i].path < d.files[j].path
+	})
+
+	windows := make(map[uint64][]windowLoc)
+	hashes := make([]uint64, 0)
+
+	for fi, file := range d.files {
+		for idx := 0; idx+d.window <= len(file.lines); idx++ {
+			hash := d.windowHash(file.lines[idx : idx+d.window])
+
+			if _, ok := windows[hash]; !ok {
+				hashes = append(hashes, hash)
+			}
+
+			windows[hash] = append(windows[hash], windowLoc{file: fi, idx: idx})
+		}
+	}
+
+	groups := make([][]windowLoc, 0)
+	groupByFirst := make(map[windowLoc]int)
+
+	for _, hash := range hashes {
+		locs := windows[hash]
+
+		if len(locs) < 2 {
+			continue
+		}
+
+		for _, loc := range locs {
+			for i := loc.idx; i < loc.idx+d.window; i++ {
+				d.files[loc.file].dup[i] = true
+			}
+		}
+
+		groupByFirst[locs[0]] = len(groups)
+		groups = append(groups, locs)
+	}
+
+	// overlapping windows of one long duplicated block form a chain,
+	// where every next group has all locations shifted by one line
+	next := make([]int, len(groups))
+	hasPrev := make([]bool, len(groups))
+
+	for g, locs := range groups {
+		next[g] = -1
+		first := windowLoc{file: locs[0].file, idx: locs[0].idx + 1}
+		n, ok := groupByFirst[first]
+
+		if !ok || len(groups[n]) != len(locs) {
+			continue
+		}
+
+		shifted := true
+
+		for i, loc := range locs {
+			if groups[n][i].file != loc.file || groups[n][i].idx != loc.idx+1 {
+				shifted = false
+				break
+			}
+		}
+
+		if shifted {
+			next[g] = n
+			hasPrev[n] = true
+		}
+	}
+
+	fragments := make([]*Fragment, 0)
+
+	for g, locs := range groups {
+		if hasPrev[g] {
+			continue
+		}
+
+		size := d.window
+
+		for n := next[g]; n != -1; n = next[n] {
+			size++
+		}
+
+		fragment := &Fragment{
+			Language:  d.files[locs[0].file].lang,
+			Lines:     size,
+			Locations: make([]*FragmentLocation, 0, len(locs)),
+		}
+
+		for _, loc := range locs {
+			file := d.files[loc.file]
+			fragment.Locations = append(fragment.Locations, &FragmentLocation{
+				Path:      file.path,
+				StartLine: file.lines[loc.idx].number,
+				EndLine:   file.lines[loc.idx+size-1].number,
+			})
+		}
+
+		fragments = append(fragments, fragment)
+	}
+
+	// the longest and the most repeated fragments first
+	sort.SliceStable(fragments, func(i, j int) bool {
+		if fragments[i].Lines == fragments[j].Lines {
+			return len(fragments[i].Locations) > len(fragments[j].Locations)
+		}
+
+		return fragments[i].Lines > fragments[j].Lines
+	})
+
+	if len(fragments) > DUPLICATION_FRAGMENTS {
+		fragments = fragments[:DUPLICATION_FRAGMENTS]
+	}
+
+	result := &Duplication{
+		Languages: make([]*LanguageDuplication, 0),
+		Fragments: fragments,
+	}
+	langs := make(map[string]*LanguageDuplication)
+
+	for _, file := range d.files {
+		lang, ok := langs[file.lang]
+
+		if !ok {
+			lang = &LanguageDuplication{Name: file.lang}
+			langs[file.lang] = lang
+			result.Languages = append(result.Languages, lang)
+		}
+
+		lang.CodeLines += int32(len(file.lines))
+
+		for _, dup := range file.dup {
+			if dup {
+				lang.DuplicatedLines++
+			}
+		}
+
+		result.CodeLines += int32(len(file.lines))
+	}
+
+	for _, lang := range result.Languages {
+		result.DuplicatedLines += lang.DuplicatedLines
+	}
+
+	sort.SliceStable(result.Languages, func(i, j int) bool {
+		lang1, lang2 := result.Languages[i], result.Languages[j]
+
+		if lang1.DuplicatedLines == lang2.DuplicatedLines {
+			return lang1.Name < lang2.Name
+		}
+
+		return lang1.DuplicatedLines > lang2.DuplicatedLines
+	})
+
+	return result
+}
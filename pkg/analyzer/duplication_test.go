@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var duplicatedBlock = `func sum(numbers []int) int {
+	total := 0
+	for _, n := range numbers {
+		total += n
+	}
+	return total
+}
+
+func avg(numbers []int) int {
+	return sum(numbers) / len(numbers)
+}
+`
+
+func TestDuplicationDetection(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	first := "package first\n\n" + duplicatedBlock
+	second := "package second\n\n// same helpers as in first.go\n" + duplicatedBlock
+	third := "package third\n\nfunc third() string {\n\treturn \"no duplicates here\"\n}\n"
+
+	os.WriteFile(filepath.Join(dir, "first.go"), []byte(first), 0644)
+	os.WriteFile(filepath.Join(dir, "second.go"), []byte(second), 0644)
+	os.WriteFile(filepath.Join(dir, "third.go"), []byte(third), 0644)
+
+	for _, parallel := range []bool{false, true} {
+		analyzer := New(&Options{DetectDuplicates: true})
+		result, _, _ := analyzer.Do(dir, parallel)
+		dup := result.Duplication
+
+		if dup == nil {
+			t.Fatalf("Expected duplication result")
+		}
+
+		// "}" lines are ignored, so every copy has 7 meaningful lines
+		if dup.DuplicatedLines != 14 {
+			t.Errorf("Expected 14 duplicated lines, got %d", dup.DuplicatedLines)
+		}
+
+		if len(dup.Fragments) != 1 {
+			t.Fatalf("Expected 1 fragment, got %d", len(dup.Fragments))
+		}
+
+		fragment := dup.Fragments[0]
+
+		if fragment.Lines != 7 {
+			t.Errorf("Expected fragment of 7 lines, got %d", fragment.Lines)
+		}
+
+		if len(fragment.Locations) != 2 {
+			t.Fatalf("Expected 2 locations, got %d", len(fragment.Locations))
+		}
+
+		want := []FragmentLocation{
+			{Path: "first.go", StartLine: 3, EndLine: 12},
+			{Path: "second.go", StartLine: 4, EndLine: 13},
+		}
+
+		for i, loc := range fragment.Locations {
+			if *loc != want[i] {
+				t.Errorf("Expected location %v, got %v", want[i], *loc)
+			}
+		}
+	}
+}
+
+func TestDuplicationDisabled(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(filepath.Join(dir, "first.go"), []byte(duplicatedBlock), 0644)
+
+	analyzer := New(&Options{})
+	result, _, _ := analyzer.Do(dir, false)
+
+	if result.Duplication != nil {
+		t.Errorf("Expected no duplication result")
+	}
+}
@@ -3,12 +3,18 @@ package analyzer
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 )
 
+const (
+	MODELINE_LINES     = 5    // modelines are looked for only in the first N lines
+	MODELINE_MAX_BYTES = 4096 // and only in the first N bytes
+)
+
 type FileInfo struct {
 	Name     string
 	Files    int32
@@ -33,33 +39,80 @@ func (this *FileInfo) onComment() {
 	this.Comments++
 }
 
+// kind of a line as classified by Reader
+type LineKind uint8
+
+const (
+	LINE_CODE LineKind = iota
+	LINE_BLANK
+	LINE_COMMENT
+)
+
+type Line struct {
+	Number int    // 1-based line number
+	Text   string // line content without surrounding whitespace
+	Kind   LineKind
+}
+
+// LineVisitor is called by ReadFile for every line of the file after it was classified
+type LineVisitor func(line *Line)
+
 func Reader(path string) *FileInfo {
+	return ReadFile(path, nil)
+}
+
+// ReadFile counts lines of the file like Reader does
+// and passes every classified line to visit if it is not nil
+func ReadFile(path string, visit LineVisitor) *FileInfo {
+	return registry.ReadFile(path, visit)
+}
+
+// ReadFile reads the file detecting its language by the registry
+func (r *LanguageRegistry) ReadFile(path string, visit LineVisitor) *FileInfo {
 	file, _ := os.Open(path)
+	defer file.Close()
 	base := filepath.Base(file.Name())
-	ext := filepath.Ext(base)
 
 	fileInfo := &FileInfo{
-		Name:     registry.GetLangByExt(ext),
+		Name:     r.GetLangByFilename(base),
 		Files:    0,
 		Lines:    0,
 		Blank:    0,
 		Comments: 0,
 	}
 
+	// scripts without extension and files with unknown ones
+	if fileInfo.Name == "Other" {
+		if langName, ok := r.detectByContent(file); ok {
+			fileInfo.Name = langName
+		}
+
+		file.Seek(0, io.SeekStart)
+	}
+
 	firstLine := true
 	inComm := false
 
 	iterateFileLines(file, func(line string, index int) {
 		line = strings.TrimSpace(line)
 		fileInfo.onLine()
+		comments := fileInfo.Comments
 
-		if firstLine {
-			if strings.HasPrefix(line, "#!") {
-				if extByShebang, ok := GetExtByShebang(line); ok {
-					fileInfo.Name = registry.GetLangByExt(extByShebang)
+		if visit != nil {
+			defer func() {
+				kind := LINE_CODE
+
+				if fileInfo.Comments > comments {
+					kind = LINE_COMMENT
+				} else if len(line) == 0 {
+					kind = LINE_BLANK
 				}
-			}
 
+				visit(&Line{Number: index + 1, Text: line, Kind: kind})
+			}()
+		}
+
+		if firstLine {
 			firstLine = false
 			fileInfo.onFile()
 		}
@@ -68,7 +121,7 @@ func Reader(path string) *FileInfo {
 			fileInfo.onBlank()
 		}
 
-		blockComments := registry.GetBlockComments(fileInfo.Name)
+		blockComments := r.GetBlockComments(fileInfo.Name)
 
 		if inComm {
 			fileInfo.onComment()
@@ -85,7 +138,7 @@ func Reader(path string) *FileInfo {
 		}
 
 		// match line comment
-		for _, lineComm := range registry.GetLineComments(fileInfo.Name) {
+		for _, lineComm := range r.GetLineComments(fileInfo.Name) {
 			if strings.HasPrefix(line, lineComm) {
 				fileInfo.onComment()
 			}
@@ -109,6 +162,31 @@ func Reader(path string) *FileInfo {
 	return fileInfo
 }
 
+// detects language by shebang of the first line or by modeline of the first lines
+func (r *LanguageRegistry) detectByContent(content io.Reader) (string, bool) {
+	s := bufio.NewScanner(io.LimitReader(content, MODELINE_MAX_BYTES))
+
+	for index := 0; index < MODELINE_LINES && s.Scan(); index++ {
+		line := strings.TrimSpace(s.Text())
+
+		if index == 0 {
+			if interpreter, ok := ParseShebang(line); ok {
+				if langName := r.GetLangByInterpreter(interpreter); langName != "Other" {
+					return langName, true
+				}
+			}
+		}
+
+		if filetype, ok := ParseModeline(line); ok {
+			if langName := r.GetLangByFiletype(filetype); langName != "Other" {
+				return langName, true
+			}
+		}
+	}
+
+	return "", false
+}
+
 var bufferPool = sync.Pool{
 	New: func() interface{} { return new(bytes.Buffer) },
 }
@@ -170,3 +170,44 @@ fi`)
 		t.Errorf("Bash. Expected 6 comments, got %d", result.Comments)
 	}
 }
+
+func TestDetectLanguageByContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		inner string
+		want  string
+	}{
+		{"script", "#!/usr/bin/env -S python3.12 -u\n# comment\nprint(1)\n", "Python"},
+		{"hook", "#!/bin/sh -e\n\n# comment\nexit 0\n", "Bourne Shell"},
+		{"Brewfile", "# comment\nbrew 'git'\n# vim: ft=ruby\n", "Ruby"},
+		{"settings.conf", "-- -*- mode: lua -*-\nreturn {}\n", "Lua"},
+		{"notes", "just text\n", "Other"},
+	}
+
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := dir + "/" + tt.name
+			os.WriteFile(path, []byte(tt.inner), 0644)
+			result := Reader(path)
+
+			if result.Name != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, result.Name)
+			}
+
+			if result.Name != "Other" && result.Comments == 0 {
+				t.Errorf("Expected comments to be counted from the first line")
+			}
+		})
+	}
+
+	// extension wins over shebang
+	path := dir + "/main.ts"
+	os.WriteFile(path, []byte("#!/usr/bin/env node\nconsole.log(1)\n"), 0644)
+
+	if result := Reader(path); result.Name != "TypeScript" {
+		t.Errorf("Expected TypeScript, got %s", result.Name)
+	}
+}
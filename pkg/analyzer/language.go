@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -12,23 +13,51 @@ type Language struct {
 	Lines    int32  `json:"lines" redis:"lines"`
 	Files    int32  `json:"files" redis:"files"`
 	BadgeUrl string `json:"badge_url" redis:"badge_url"`
+	Type     string `json:"type" redis:"type"`
+	Color    string `json:"color" redis:"color"`
+
+	Roles []*LanguageRole `json:"roles" redis:"roles"` // breakdown by file role, filled by the result
+
+	// counters by role, all roles are created at once,
+	// so the map is only read while files are analyzed concurrently
+	roles map[string]*LanguageRole
 }
 
 func NewLanguage(name string) *Language {
+	roles := make(map[string]*LanguageRole, len(Roles))
+
+	for _, role := range Roles {
+		roles[role] = &LanguageRole{Role: role}
+	}
+
 	return &Language{
 		Name:     name,
 		Blank:    0,
 		Comments: 0,
 		Lines:    0,
 		Files:    0,
+		roles:    roles,
 	}
 }
 
-func DefinedLanguages() map[string]*Language {
+// language counter with metadata of the registry
+func (r *LanguageRegistry) NewLanguage(name string) *Language {
+	lang := NewLanguage(name)
+
+	if data, ok := r.langsByName[name]; ok {
+		lang.Type = data.Type
+		lang.Color = data.Color
+	}
+
+	return lang
+}
+
+// counters for every language of the registry
+func (r *LanguageRegistry) DefinedLanguages() map[string]*Language {
 	m := make(map[string]*Language)
 
-	for _, lang := range registry.GetLangs() {
-		m[lang] = NewLanguage(lang)
+	for _, lang := range r.GetLangs() {
+		m[lang] = r.NewLanguage(lang)
 	}
 
 	m["Other"] = NewLanguage("Other")
@@ -36,19 +65,12 @@ func DefinedLanguages() map[string]*Language {
 	return m
 }
 
-var shebangExts = map[string]string{
-	"node":    "js",
-	"python":  "py",
-	"python3": "py",
-	"perl":    "pl",
-	"ruby":    "rb",
-	"make":    "make",
-	"rc":      "plan9sh",
-	"gosh":    "scm",
-	"escript": "erl",
-}
+// options of env taking a separate argument: env -u NAME python
+var envArgOptions = map[string]bool{"-u": true, "--unset": true, "-C": true, "--chdir": true}
 
-func GetExtByShebang(line string) (lang string, ok bool) {
+// returns base name of the interpreter of a shebang line,
+// supports env with options and variables: #!/usr/bin/env -S deno run
+func ParseShebang(line string) (interpreter string, ok bool) {
 	if !strings.HasPrefix(line, "#!") {
 		return "", false
 	}
@@ -59,19 +81,49 @@ func GetExtByShebang(line string) (lang string, ok bool) {
 		return "", false
 	}
 
-	if len(parts) == 2 {
-		interpreter := parts[1]
+	interpreter = filepath.Base(parts[0])
 
-		if ext, ok := shebangExts[parts[1]]; ok {
-			interpreter = ext
+	if interpreter != "env" {
+		return interpreter, true
+	}
+
+	for i := 1; i < len(parts); i++ {
+		arg := parts[i]
+
+		switch {
+		case envArgOptions[arg]:
+			i++
+		case strings.HasPrefix(arg, "-S") && len(arg) > 2:
+			// -Spython3 -u
+			return filepath.Base(arg[2:]), true
+		case strings.HasPrefix(arg, "-"), strings.Contains(arg, "="):
+			// other options and variable assignments
+		default:
+			return filepath.Base(arg), true
 		}
+	}
 
-		return interpreter, true
+	return "", false
+}
+
+var (
+	vimModelineRegexp   = regexp.MustCompile(`(?:^|\s)(?:vim?|ex):.*?\b(?:ft|filetype|syntax|syn)=([\w+#-]+)`)
+	emacsModelineRegexp = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*([\w+#-]+)|([\w+#-]+))\s*(?:;.*)?-\*-`)
+)
+
+// returns file type of Vim "vim: ft=ruby" or Emacs "-*- mode: lisp -*-" modeline
+func ParseModeline(line string) (filetype string, ok bool) {
+	if matches := vimModelineRegexp.FindStringSubmatch(line); matches != nil {
+		return matches[1], true
 	}
 
-	if ext, ok := shebangExts[filepath.Base(parts[0])]; ok {
-		return ext, ok
+	if matches := emacsModelineRegexp.FindStringSubmatch(line); matches != nil {
+		if matches[1] != "" {
+			return matches[1], true
+		}
+
+		return matches[2], true
 	}
 
-	return filepath.Base(parts[0]), true
+	return "", false
 }
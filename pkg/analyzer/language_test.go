@@ -4,35 +4,84 @@ import (
 	"testing"
 )
 
-func TestGetExtByShebang(t *testing.T) {
+func TestParseShebang(t *testing.T) {
 	tests := []struct {
 		shebang string
 		want    string
+		lang    string
 	}{
-		{"#!/bin/sh", "sh"},
-		{"#!/usr/bin/env python3", "py"},
-		{"#!/usr/bin/bash", "bash"},
-		{"#!/usr/bin/perl", "pl"},
-		{"#!/usr/bin/ruby", "rb"},
-		{"#!/usr/bin/env node", "js"},
-		{"#!/usr/bin/php", "php"},
-		{"#!/usr/bin/env python", "py"},
-		{"#!/usr/bin/env zsh", "zsh"},
-		{"#!/usr/bin/lua", "lua"},
-		{"#!/usr/bin/env groovy", "groovy"},
-		{"#!/usr/bin/env ksh", "ksh"},
-		{"#!/usr/bin/fish", "fish"},
-		{"#!/usr/bin/env awk", "awk"},
+		{"#!/bin/sh", "sh", "Bourne Shell"},
+		{"#!/bin/sh -e", "sh", "Bourne Shell"},
+		{"#!/usr/bin/env python3", "python3", "Python"},
+		{"#!/usr/bin/python3.11", "python3.11", "Python"},
+		{"#!/usr/bin/bash", "bash", "Bash"},
+		{"#!/usr/bin/perl -w", "perl", "Perl"},
+		{"#!/usr/bin/ruby", "ruby", "Ruby"},
+		{"#!/usr/bin/env node", "node", "JavaScript"},
+		{"#!/usr/bin/env -S deno run --allow-net", "deno", "TypeScript"},
+		{"#!/usr/bin/env -Spython3 -u", "python3", "Python"},
+		{"#!/usr/bin/env -u HOME LANG=C lua5.4", "lua5.4", "Lua"},
+		{"#!/usr/bin/php", "php", "PHP"},
+		{"#!/usr/bin/env zsh", "zsh", "Zsh"},
+		{"#!/usr/bin/env groovy", "groovy", "Groovy"},
+		{"#!/usr/bin/fish", "fish", "Fish"},
+		{"#!/usr/bin/awk -f", "awk", "Awk"},
+		{"#!/usr/bin/env unknown", "unknown", "Other"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.shebang, func(t *testing.T) {
-			got, _ := GetExtByShebang(tt.shebang)
+			got, ok := ParseShebang(tt.shebang)
 
-			if tt.want != got {
-				t.Errorf("Expected %s got %s", tt.want, got)
-				t.Fail()
+			if !ok || got != tt.want {
+				t.Errorf("ParseShebang(%q) = %q; want %q", tt.shebang, got, tt.want)
+			}
+
+			if lang := registry.GetLangByInterpreter(got); lang != tt.lang {
+				t.Errorf("GetLangByInterpreter(%q) = %q; want %q", got, lang, tt.lang)
 			}
 		})
 	}
+
+	for _, line := range []string{"# comment", "#!", "#!/usr/bin/env -i"} {
+		if got, ok := ParseShebang(line); ok {
+			t.Errorf("ParseShebang(%q) = %q; want no interpreter", line, got)
+		}
+	}
+}
+
+func TestParseModeline(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		lang string
+	}{
+		{"# vim: ft=ruby", "ruby", "Ruby"},
+		{"# vim: set filetype=python :", "python", "Python"},
+		{"// vi: syntax=javascript", "javascript", "JavaScript"},
+		{"/* vim: set ts=4 sw=4 ft=cpp: */", "cpp", "C++"},
+		{";; -*- mode: lisp -*-", "lisp", "LISP"},
+		{"# -*- coding: utf-8; mode: shell-script -*-", "shell-script", "Bourne Shell"},
+		{"// -*- C++ -*-", "C++", "C++"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := ParseModeline(tt.line)
+
+			if !ok || got != tt.want {
+				t.Errorf("ParseModeline(%q) = %q; want %q", tt.line, got, tt.want)
+			}
+
+			if lang := registry.GetLangByFiletype(got); lang != tt.lang {
+				t.Errorf("GetLangByFiletype(%q) = %q; want %q", got, lang, tt.lang)
+			}
+		})
+	}
+
+	for _, line := range []string{"# -*- coding: utf-8 -*-", "// environment: ft=ruby", "evim: ft=ruby"} {
+		if got, ok := ParseModeline(line); ok {
+			t.Errorf("ParseModeline(%q) = %q; want no file type", line, got)
+		}
+	}
 }
@@ -0,0 +1,326 @@
+package analyzer
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	LICENSE_MIN_CONFIDENCE = 0.75 // min similarity to consider a license file matched
+	LICENSE_HEADER_LINES   = 20   // SPDX headers are looked for only in the first N lines
+	LICENSE_MAX_FILE_SIZE  = 256 * 1024
+)
+
+// SPDX license texts, file name is the SPDX identifier. GNU licenses are the -only ones,
+// the text of the -or-later ones is the same
+//
+//go:embed licenses/*.txt
+var licenseTemplates embed.FS
+
+var (
+	copyrightRegexp     = regexp.MustCompile(`^\s*copyright\s*(\(c\)|©|\d|<)`)
+	licenseFileRegexp   = regexp.MustCompile(`(?i)^(license|licence|copying|unlicense)([-_.][\w.-]*)?$`)
+	spdxHeaderRegexp    = regexp.MustCompile(`SPDX-License-Identifier:\s*(.+)$`)
+	spdxTrailerReplacer = strings.NewReplacer("*/", "", "-->", "", "-}", "", "*)", "")
+	spdxTokenRegexp     = regexp.MustCompile(`[A-Za-z0-9.+-]+`)
+	laterVersionRegexp  = regexp.MustCompile(`\(at\s+your\s+option\)\s+any\s+later\s+version`)
+	applyTermsRegexp    = regexp.MustCompile(`(?i)how\s+to\s+apply\s+these\s+terms`)
+)
+
+// deprecated SPDX identifiers by lowercase id and the current expressions replacing them
+var deprecatedSPDX = map[string]string{
+	"gpl-1.0":                          "GPL-1.0-only",
+	"gpl-1.0+":                         "GPL-1.0-or-later",
+	"gpl-2.0":                          "GPL-2.0-only",
+	"gpl-2.0+":                         "GPL-2.0-or-later",
+	"gpl-3.0":                          "GPL-3.0-only",
+	"gpl-3.0+":                         "GPL-3.0-or-later",
+	"lgpl-2.0":                         "LGPL-2.0-only",
+	"lgpl-2.0+":                        "LGPL-2.0-or-later",
+	"lgpl-2.1":                         "LGPL-2.1-only",
+	"lgpl-2.1+":                        "LGPL-2.1-or-later",
+	"lgpl-3.0":                         "LGPL-3.0-only",
+	"lgpl-3.0+":                        "LGPL-3.0-or-later",
+	"agpl-1.0":                         "AGPL-1.0-only",
+	"agpl-3.0":                         "AGPL-3.0-only",
+	"gfdl-1.1":                         "GFDL-1.1-only",
+	"gfdl-1.2":                         "GFDL-1.2-only",
+	"gfdl-1.3":                         "GFDL-1.3-only",
+	"gpl-2.0-with-autoconf-exception":  "GPL-2.0-only WITH Autoconf-exception-2.0",
+	"gpl-2.0-with-classpath-exception": "GPL-2.0-only WITH Classpath-exception-2.0",
+	"gpl-2.0-with-font-exception":      "GPL-2.0-only WITH Font-exception-2.0",
+	"gpl-2.0-with-gcc-exception":       "GPL-2.0-only WITH GCC-exception-2.0",
+	"gpl-3.0-with-autoconf-exception":  "GPL-3.0-only WITH Autoconf-exception-3.0",
+	"gpl-3.0-with-gcc-exception":       "GPL-3.0-only WITH GCC-exception-3.1",
+	"bsd-2-clause-freebsd":             "BSD-2-Clause",
+	"bsd-2-clause-netbsd":              "BSD-2-Clause",
+	"standardml-nj":                    "SMLNJ",
+}
+
+type LicenseFile struct {
+	Path       string  `json:"path" redis:"path"`
+	License    string  `json:"license" redis:"license"` // SPDX identifier, empty if not recognized
+	Confidence float64 `json:"confidence" redis:"confidence"`
+}
+
+type LicenseHeader struct {
+	License string `json:"license" redis:"license"` // SPDX license expression
+	Files   int32  `json:"files" redis:"files"`
+}
+
+type License struct {
+	Primary    string           `json:"primary" redis:"primary"` // SPDX identifier of the repository license
+	Confidence float64          `json:"confidence" redis:"confidence"`
+	Files      []*LicenseFile   `json:"files" redis:"files"`     // license files in the repository root
+	Headers    []*LicenseHeader `json:"headers" redis:"headers"` // SPDX-License-Identifier usage in source files
+}
+
+type licenseTemplate struct {
+	id      string
+	bigrams map[string]struct{}
+}
+
+var (
+	templates         []*licenseTemplate
+	onceLoadTemplates sync.Once
+)
+
+func loadLicenseTemplates() {
+	entries, _ := licenseTemplates.ReadDir("licenses")
+
+	for _, entry := range entries {
+		text, err := licenseTemplates.ReadFile("licenses/" + entry.Name())
+
+		if err != nil {
+			continue
+		}
+
+		templates = append(templates, &licenseTemplate{
+			id:      strings.TrimSuffix(entry.Name(), ".txt"),
+			bigrams: licenseBigrams(string(text)),
+		})
+	}
+}
+
+// normalize license text to a set of word pairs,
+// copyright lines are dropped because they differ in every repository
+func licenseBigrams(text string) map[string]struct{} {
+	words := make([]string, 0)
+
+	for _, line := range strings.Split(strings.ToLower(text), "\n") {
+		if copyrightRegexp.MatchString(line) {
+			continue
+		}
+
+		words = append(words, strings.FieldsFunc(line, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		})...)
+	}
+
+	bigrams := make(map[string]struct{}, len(words))
+
+	for i := 0; i+1 < len(words); i++ {
+		bigrams[words[i]+" "+words[i+1]] = struct{}{}
+	}
+
+	return bigrams
+}
+
+// Sørensen–Dice coefficient of two bigram sets
+func licenseSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+
+	for bigram := range a {
+		if _, ok := b[bigram]; ok {
+			common++
+		}
+	}
+
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// returns SPDX identifier of the best matching license template
+func MatchLicense(text string) (string, float64) {
+	onceLoadTemplates.Do(loadLicenseTemplates)
+
+	bigrams := licenseBigrams(text)
+	bestID, bestScore := "", 0.0
+
+	for _, tmpl := range templates {
+		if score := licenseSimilarity(bigrams, tmpl.bigrams); score > bestScore {
+			bestID, bestScore = tmpl.id, score
+		}
+	}
+
+	if bestScore < LICENSE_MIN_CONFIDENCE {
+		return "", bestScore
+	}
+
+	return laterVersionID(bestID, text), bestScore
+}
+
+// the -or-later id of a GNU license if the text allows any later version. The notice saying so
+// is quoted by the "How to Apply These Terms" appendix of the license, so it is not looked for there
+func laterVersionID(id, text string) string {
+	if !strings.HasSuffix(id, "-only") {
+		return id
+	}
+
+	if loc := applyTermsRegexp.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+
+	if laterVersionRegexp.MatchString(strings.ToLower(text)) {
+		return strings.TrimSuffix(id, "-only") + "-or-later"
+	}
+
+	return id
+}
+
+// returns SPDX license expression if the line is SPDX-License-Identifier header
+func ParseSPDXHeader(line string) (string, bool) {
+	if !strings.Contains(line, "SPDX-License-Identifier") {
+		return "", false
+	}
+
+	matches := spdxHeaderRegexp.FindStringSubmatch(line)
+
+	if matches == nil {
+		return "", false
+	}
+
+	expr := strings.TrimSpace(spdxTrailerReplacer.Replace(matches[1]))
+
+	// deprecated identifiers are counted with the current ones
+	expr = spdxTokenRegexp.ReplaceAllStringFunc(expr, func(token string) string {
+		if id, ok := deprecatedSPDX[strings.ToLower(token)]; ok {
+			return id
+		}
+
+		return token
+	})
+
+	return expr, expr != ""
+}
+
+// LicenseDetector matches license files of the repository root against
+// embedded SPDX templates and counts SPDX headers of analyzed files
+type LicenseDetector struct {
+	mu      sync.Mutex
+	files   []*LicenseFile
+	headers map[string]int32
+}
+
+func NewLicenseDetector() *LicenseDetector {
+	return &LicenseDetector{
+		files:   make([]*LicenseFile, 0),
+		headers: make(map[string]int32),
+	}
+}
+
+// match LICENSE, COPYING and similar files located directly in the root
+func (d *LicenseDetector) ScanRoot(root string) {
+	entries, err := os.ReadDir(root)
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !licenseFileRegexp.MatchString(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil || info.Size() > LICENSE_MAX_FILE_SIZE {
+			continue
+		}
+
+		text, err := os.ReadFile(filepath.Join(root, entry.Name()))
+
+		if err != nil {
+			continue
+		}
+
+		id, confidence := MatchLicense(string(text))
+
+		d.mu.Lock()
+		d.files = append(d.files, &LicenseFile{
+			Path:       entry.Name(),
+			License:    id,
+			Confidence: confidence,
+		})
+		d.mu.Unlock()
+	}
+}
+
+func (d *LicenseDetector) AddHeader(expr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.headers[expr]++
+}
+
+func (d *LicenseDetector) Result() *License {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := &License{
+		Files:   d.files,
+		Headers: make([]*LicenseHeader, 0, len(d.headers)),
+	}
+
+	// LICENSE files are preferred over COPYING ones, then the most confident match wins
+	var primary *LicenseFile
+
+	for _, file := range d.files {
+		if file.License == "" {
+			continue
+		}
+
+		if primary == nil || isCopyingFile(primary) && !isCopyingFile(file) ||
+			isCopyingFile(primary) == isCopyingFile(file) && file.Confidence > primary.Confidence {
+			primary = file
+		}
+	}
+
+	if primary != nil {
+		result.Primary = primary.License
+		result.Confidence = primary.Confidence
+	}
+
+	for expr, files := range d.headers {
+		result.Headers = append(result.Headers, &LicenseHeader{License: expr, Files: files})
+	}
+
+	sort.SliceStable(result.Headers, func(i, j int) bool {
+		h1, h2 := result.Headers[i], result.Headers[j]
+
+		if h1.Files == h2.Files {
+			return h1.License < h2.License
+		}
+
+		return h1.Files > h2.Files
+	})
+
+	// without license files the most used SPDX header is the best guess
+	if result.Primary == "" && len(result.Headers) > 0 {
+		result.Primary = result.Headers[0].License
+	}
+
+	return result
+}
+
+func isCopyingFile(file *LicenseFile) bool {
+	return strings.HasPrefix(strings.ToLower(file.Path), "copying")
+}
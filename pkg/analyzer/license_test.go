@@ -0,0 +1,133 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchLicense(t *testing.T) {
+	mit := `MIT License
+
+Copyright (c) 2024 Someone
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.`
+
+	isc := `Copyright (c) 2015, Someone
+
+Permission to use, copy, modify, and/or distribute this software for any
+purpose with or without fee is hereby granted, provided that the above
+copyright notice and this permission notice appear in all copies.
+
+THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.`
+
+	gpl2, _ := licenseTemplates.ReadFile("licenses/GPL-2.0-only.txt")
+	lgpl3, _ := licenseTemplates.ReadFile("licenses/LGPL-3.0-only.txt")
+
+	notice := `This program is free software; you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation; either version 2 of the License, or
+(at your option) any later version.
+
+`
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"MIT", mit, "MIT"},
+		{"ISC", isc, "ISC"},
+		// the appendix of the license quotes the notice, it does not apply to the program
+		{"GPL-2.0", string(gpl2), "GPL-2.0-only"},
+		{"GPL-2.0 with notice", notice + string(gpl2), "GPL-2.0-or-later"},
+		{"LGPL-3.0", string(lgpl3), "LGPL-3.0-only"},
+		{"Not a license", "# My project\n\nSome readme text", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confidence := MatchLicense(tt.text)
+
+			if got != tt.want {
+				t.Errorf("MatchLicense() = %q (%.2f); want %q", got, confidence, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSPDXHeader(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"// SPDX-License-Identifier: MIT", "MIT"},
+		{"/* SPDX-License-Identifier: GPL-2.0-only OR MIT */", "GPL-2.0-only OR MIT"},
+		{"<!-- SPDX-License-Identifier: Apache-2.0 -->", "Apache-2.0"},
+		// deprecated identifiers are replaced by the current ones
+		{"// SPDX-License-Identifier: GPL-2.0", "GPL-2.0-only"},
+		{"// SPDX-License-Identifier: GPL-2.0+", "GPL-2.0-or-later"},
+		{"/* SPDX-License-Identifier: (LGPL-2.1 OR MIT) */", "(LGPL-2.1-only OR MIT)"},
+		{"# SPDX-License-Identifier: GPL-2.0-with-classpath-exception", "GPL-2.0-only WITH Classpath-exception-2.0"},
+		{"// Copyright 2024", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, _ := ParseSPDXHeader(tt.line)
+
+			if got != tt.want {
+				t.Errorf("ParseSPDXHeader(%q) = %q; want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLicense(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	apache, _ := licenseTemplates.ReadFile("licenses/Apache-2.0.txt")
+	os.WriteFile(filepath.Join(dir, "LICENSE"), apache, 0644)
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("// SPDX-License-Identifier: Apache-2.0\npackage a\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.go"), []byte("// SPDX-License-Identifier: Apache-2.0\npackage b\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "c.go"), []byte("// SPDX-License-Identifier: MIT\npackage c\n"), 0644)
+
+	analyzer := New(&Options{})
+	result, _, _ := analyzer.Do(dir, false)
+	license := result.License
+
+	if license.Primary != "Apache-2.0" {
+		t.Errorf("Expected Apache-2.0, got %q", license.Primary)
+	}
+
+	if len(license.Files) != 1 || license.Files[0].Path != "LICENSE" {
+		t.Errorf("Expected LICENSE file, got %v", license.Files)
+	}
+
+	if len(license.Headers) != 2 || license.Headers[0].License != "Apache-2.0" || license.Headers[0].Files != 2 {
+		t.Errorf("Unexpected headers %v", license.Headers)
+	}
+}
@@ -0,0 +1,208 @@
+package analyzer
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	MARKERS_LIMIT = 500 // max number of reported marker occurrences
+)
+
+var defaultMarkerTags = []string{"TODO", "FIXME", "HACK", "XXX"}
+
+type MarkerOccurrence struct {
+	Tag      string `json:"tag" redis:"tag"`
+	Language string `json:"language" redis:"language"`
+	Path     string `json:"path" redis:"path"`
+	Line     int    `json:"line" redis:"line"`
+	Text     string `json:"text" redis:"text"`
+}
+
+type LanguageMarkers struct {
+	Name   string           `json:"name" redis:"name"`
+	Total  int32            `json:"total" redis:"total"`
+	Counts map[string]int32 `json:"counts" redis:"counts"` // occurrences by tag
+}
+
+type Markers struct {
+	Tags        []string            `json:"tags" redis:"tags"`
+	Total       int32               `json:"total" redis:"total"`
+	Counts      map[string]int32    `json:"counts" redis:"counts"`
+	Languages   []*LanguageMarkers  `json:"languages" redis:"languages"`
+	Occurrences []*MarkerOccurrence `json:"occurrences" redis:"occurrences"`
+	Truncated   bool                `json:"truncated" redis:"truncated"` // occurrences are capped by MARKERS_LIMIT
+}
+
+// MarkerScanner looks for tech-debt markers like TODO or FIXME in comment lines.
+// All occurrences are counted, but only the first MARKERS_LIMIT of them by path and line are kept
+type MarkerScanner struct {
+	mu          sync.Mutex
+	tags        []string
+	re          *regexp.Regexp
+	occurrences markerHeap
+	total       int32
+	counts      map[string]int32
+	languages   map[string]*LanguageMarkers
+}
+
+// kept occurrences with the last one by path and line on top, so it is the one replaced
+type markerHeap []*MarkerOccurrence
+
+func (h markerHeap) Len() int           { return len(h) }
+func (h markerHeap) Less(i, j int) bool { return markerBefore(h[j], h[i]) }
+func (h markerHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *markerHeap) Push(x any)        { *h = append(*h, x.(*MarkerOccurrence)) }
+
+func (h *markerHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return last
+}
+
+func markerBefore(occ1, occ2 *MarkerOccurrence) bool {
+	if occ1.Path == occ2.Path {
+		return occ1.Line < occ2.Line
+	}
+
+	return occ1.Path < occ2.Path
+}
+
+// tags are matched as whole words, custom tags are added to the default ones
+func NewMarkerScanner(tags []string) *MarkerScanner {
+	uniq := make([]string, 0, len(defaultMarkerTags)+len(tags))
+	seen := make(map[string]bool)
+
+	// tags can be also passed as a comma separated list
+	for _, tag := range strings.Split(strings.Join(slices.Concat(defaultMarkerTags, tags), ","), ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		uniq = append(uniq, tag)
+	}
+
+	quoted := make([]string, len(uniq))
+
+	for i, tag := range uniq {
+		quoted[i] = regexp.QuoteMeta(tag)
+	}
+
+	return &MarkerScanner{
+		tags:        uniq,
+		re:          regexp.MustCompile(`(?:^|[^\w])(` + strings.Join(quoted, "|") + `)(?:[^\w]|$)`),
+		occurrences: make(markerHeap, 0),
+		counts:      make(map[string]int32),
+		languages:   make(map[string]*LanguageMarkers),
+	}
+}
+
+// returns the first marker tag found in the comment text
+func (m *MarkerScanner) Match(text string) (string, bool) {
+	matches := m.re.FindStringSubmatch(text)
+
+	if matches == nil {
+		return "", false
+	}
+
+	return matches[1], true
+}
+
+func (m *MarkerScanner) Add(occurrences []*MarkerOccurrence) {
+	if len(occurrences) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, occ := range occurrences {
+		lang, ok := m.languages[occ.Language]
+
+		if !ok {
+			lang = &LanguageMarkers{Name: occ.Language, Counts: make(map[string]int32)}
+			m.languages[occ.Language] = lang
+		}
+
+		lang.Total++
+		lang.Counts[occ.Tag]++
+		m.counts[occ.Tag]++
+		m.total++
+
+		// files are analyzed in parallel, the first occurrences are kept to get a stable result
+		if len(m.occurrences) < MARKERS_LIMIT {
+			heap.Push(&m.occurrences, occ)
+		} else if markerBefore(occ, m.occurrences[0]) {
+			m.occurrences[0] = occ
+			heap.Fix(&m.occurrences, 0)
+		}
+	}
+}
+
+func (m *MarkerScanner) Result() *Markers {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := &Markers{
+		Tags:        m.tags,
+		Total:       m.total,
+		Counts:      maps.Clone(m.counts),
+		Languages:   make([]*LanguageMarkers, 0, len(m.languages)),
+		Occurrences: slices.Clone(m.occurrences),
+		Truncated:   m.total > MARKERS_LIMIT,
+	}
+
+	for _, lang := range m.languages {
+		result.Languages = append(result.Languages, &LanguageMarkers{Name: lang.Name, Total: lang.Total, Counts: maps.Clone(lang.Counts)})
+	}
+
+	sort.SliceStable(result.Languages, func(i, j int) bool {
+		lang1, lang2 := result.Languages[i], result.Languages[j]
+
+		if lang1.Total == lang2.Total {
+			return lang1.Name < lang2.Name
+		}
+
+		return lang1.Total > lang2.Total
+	})
+
+	sort.Slice(result.Occurrences, func(i, j int) bool {
+		return markerBefore(result.Occurrences[i], result.Occurrences[j])
+	})
+
+	return result
+}
+
+// write marker occurrences as CSV with a header row
+func (m *Markers) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"tag", "language", "path", "line", "text"}); err != nil {
+		return err
+	}
+
+	for _, occ := range m.Occurrences {
+		record := []string{occ.Tag, occ.Language, occ.Path, strconv.Itoa(occ.Line), occ.Text}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMarkerMatch(t *testing.T) {
+	scanner := NewMarkerScanner([]string{"NOTE, TODO", ""})
+
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"// TODO: remove this", "TODO", true},
+		{"# NOTE(alex) keep in sync", "NOTE", true},
+		{"// TODOS are not markers", "", false},
+		{"// FIXME is kept with custom tags", "FIXME", true},
+		{"// OPTIMIZE is not configured", "", false},
+		{"/* autotodo */", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := scanner.Match(tt.text)
+
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Match(%q) = %q, %v; want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMarkerTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{"TODO", "FIXME", "HACK", "XXX"}},
+		{[]string{"NOTE"}, []string{"TODO", "FIXME", "HACK", "XXX", "NOTE"}},
+		{[]string{"FIXME, NOTE", " NOTE ", "OPTIMIZE"}, []string{"TODO", "FIXME", "HACK", "XXX", "NOTE", "OPTIMIZE"}},
+	}
+
+	for _, tt := range tests {
+		if got := NewMarkerScanner(tt.tags).tags; !slices.Equal(got, tt.want) {
+			t.Errorf("NewMarkerScanner(%q) tags = %q; want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestScanMarkers(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	goFile := `package main
+
+// TODO: handle errors
+func main() {
+	todo := "TODO in code is not a comment"
+	println(todo) // FIXME trailing comments are not comment lines
+}
+
+/*
+HACK: block comments are scanned too
+*/
+`
+	pyFile := `# XXX python marker
+print("hello")
+`
+
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(goFile), 0644)
+	os.WriteFile(filepath.Join(dir, "main.py"), []byte(pyFile), 0644)
+
+	analyzer := New(&Options{ScanMarkers: true})
+	result, _, _ := analyzer.Do(dir, false)
+	markers := result.Markers
+
+	if markers == nil {
+		t.Fatalf("Expected markers result")
+	}
+
+	if markers.Total != 3 {
+		t.Errorf("Expected 3 markers, got %d", markers.Total)
+	}
+
+	if markers.Counts["TODO"] != 1 || markers.Counts["HACK"] != 1 || markers.Counts["XXX"] != 1 {
+		t.Errorf("Unexpected counts %v", markers.Counts)
+	}
+
+	if len(markers.Languages) != 2 || markers.Languages[0].Name != "Go" || markers.Languages[0].Total != 2 {
+		t.Errorf("Expected Go with 2 markers first, got %v", markers.Languages)
+	}
+
+	first := markers.Occurrences[0]
+
+	if first.Path != "main.go" || first.Line != 3 || first.Tag != "TODO" {
+		t.Errorf("Unexpected first occurrence %v", *first)
+	}
+
+	buf := &bytes.Buffer{}
+	markers.WriteCSV(buf)
+	want := "tag,language,path,line,text\n" +
+		"TODO,Go,main.go,3,// TODO: handle errors\n" +
+		"HACK,Go,main.go,10,HACK: block comments are scanned too\n" +
+		"XXX,Python,main.py,1,# XXX python marker\n"
+
+	if buf.String() != want {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestMarkersLimit(t *testing.T) {
+	scanner := NewMarkerScanner(nil)
+
+	// files come in any order, the first occurrences by path and line are kept
+	for file := 9; file >= 0; file-- {
+		occurrences := make([]*MarkerOccurrence, 0, MARKERS_LIMIT/5)
+
+		for line := range MARKERS_LIMIT / 5 {
+			occurrences = append(occurrences, &MarkerOccurrence{Tag: "TODO", Language: "Go", Path: fmt.Sprintf("file%d.go", file), Line: line + 1})
+		}
+
+		scanner.Add(occurrences)
+
+		if len(scanner.occurrences) > MARKERS_LIMIT {
+			t.Fatalf("Expected at most %d occurrences kept, got %d", MARKERS_LIMIT, len(scanner.occurrences))
+		}
+	}
+
+	markers := scanner.Result()
+
+	if markers.Total != 2*MARKERS_LIMIT || markers.Counts["TODO"] != 2*MARKERS_LIMIT || markers.Languages[0].Total != 2*MARKERS_LIMIT {
+		t.Errorf("Expected all %d occurrences counted, got %d %v", 2*MARKERS_LIMIT, markers.Total, markers.Counts)
+	}
+
+	if !markers.Truncated || len(markers.Occurrences) != MARKERS_LIMIT {
+		t.Fatalf("Expected %d occurrences reported, got %d", MARKERS_LIMIT, len(markers.Occurrences))
+	}
+
+	first, last := markers.Occurrences[0], markers.Occurrences[MARKERS_LIMIT-1]
+
+	if first.Path != "file0.go" || first.Line != 1 || last.Path != "file4.go" || last.Line != MARKERS_LIMIT/5 {
+		t.Errorf("Unexpected reported occurrences from %v to %v", *first, *last)
+	}
+}
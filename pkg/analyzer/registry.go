@@ -1,27 +1,57 @@
 package analyzer
 
 import (
+	"bytes"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"git-analyzer/pkg/config"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 )
 
 type LanguageData struct {
-	Name          string     `json:"name"`
-	Extensions    []string   `json:"extensions"`
-	LineComments  []string   `json:"lineComment"`
-	BlockComments [][]string `json:"blockComment"`
+	Name          string              `json:"name"`
+	Extensions    []string            `json:"extensions"`
+	LineComments  []string            `json:"lineComment"`
+	BlockComments [][]string          `json:"blockComment"`
+	Filenames     []string            `json:"filenames"`    // exact file names without extension like Makefile
+	Roles         map[string][]string `json:"roles"`        // file name patterns by role, see role.go
+	Type          string              `json:"type"`         // one of LanguageTypes
+	Color         string              `json:"color"`        // hex color like #00ADD8
+	Aliases       []string            `json:"aliases"`      // alternative names like golang
+	Group         string              `json:"group"`        // name of the language it can be collapsed into
+	Logo          string              `json:"logo"`         // simple-icons slug used by badges
+	Interpreters  []string            `json:"interpreters"` // shebang interpreters without version like python
 }
 
+// language types, same as in github linguist
+const (
+	LANG_TYPE_PROGRAMMING = "programming"
+	LANG_TYPE_MARKUP      = "markup"
+	LANG_TYPE_DATA        = "data"
+	LANG_TYPE_PROSE       = "prose"
+)
+
+var LanguageTypes = []string{LANG_TYPE_PROGRAMMING, LANG_TYPE_MARKUP, LANG_TYPE_DATA, LANG_TYPE_PROSE}
+
+var colorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
 var registry *LanguageRegistry
 
 type LanguageRegistry struct {
-	langsByName   map[string]*LanguageData
-	langnameByExt map[string]string
+	langsByName        map[string]*LanguageData
+	langnameByExt      map[string]string
+	langnameByFilename map[string]string
+	langnameByAlias    map[string]string // lower cased names and aliases
+	langnameByInterp   map[string]string
 }
 
 func (r *LanguageRegistry) GetLangs() []string {
@@ -52,6 +82,101 @@ func (r *LanguageRegistry) GetLangByExt(ext string) string {
 	return langName
 }
 
+// all definitions sorted by name
+func (r *LanguageRegistry) Languages() []*LanguageData {
+	langs := make([]*LanguageData, 0, len(r.langsByName))
+
+	for _, data := range r.langsByName {
+		langs = append(langs, data)
+	}
+
+	sort.Slice(langs, func(i, j int) bool {
+		return strings.ToLower(langs[i].Name) < strings.ToLower(langs[j].Name)
+	})
+
+	return langs
+}
+
+// detects language of the file the same way ReadFile does,
+// head is the beginning of the file used for shebang and modeline detection, may be empty
+func (r *LanguageRegistry) Detect(filename string, head []byte) string {
+	langName := r.GetLangByFilename(filepath.Base(filename))
+
+	if langName != "Other" || len(head) == 0 {
+		return langName
+	}
+
+	if detected, ok := r.detectByContent(bytes.NewReader(head)); ok {
+		return detected
+	}
+
+	return langName
+}
+
+func (r *LanguageRegistry) GetLanguage(langName string) (*LanguageData, bool) {
+	data, ok := r.langsByName[langName]
+
+	return data, ok
+}
+
+// finds language by its name or alias ignoring case
+func (r *LanguageRegistry) FindLanguage(nameOrAlias string) (*LanguageData, bool) {
+	langName, ok := r.langnameByAlias[strings.ToLower(strings.TrimSpace(nameOrAlias))]
+
+	if !ok {
+		return nil, false
+	}
+
+	return r.GetLanguage(langName)
+}
+
+// returns name of the group the language belongs to, the language itself if it has no group
+func (r *LanguageRegistry) GetGroup(langName string) string {
+	if data, ok := r.langsByName[langName]; ok && data.Group != "" {
+		return data.Group
+	}
+
+	return langName
+}
+
+var interpreterVersionRegexp = regexp.MustCompile(`[\d.]+$`)
+
+// returns language by interpreter name, version suffixes like python3.11 are ignored
+func (r *LanguageRegistry) GetLangByInterpreter(interpreter string) string {
+	if langName, ok := r.langnameByInterp[interpreter]; ok {
+		return langName
+	}
+
+	if langName, ok := r.langnameByInterp[interpreterVersionRegexp.ReplaceAllString(interpreter, "")]; ok {
+		return langName
+	}
+
+	return "Other"
+}
+
+// returns language by modeline file type like ruby, sh or c++,
+// looked up by names and aliases, then interpreters and extensions
+func (r *LanguageRegistry) GetLangByFiletype(filetype string) string {
+	if data, ok := r.FindLanguage(filetype); ok {
+		return data.Name
+	}
+
+	if langName := r.GetLangByInterpreter(filetype); langName != "Other" {
+		return langName
+	}
+
+	return r.GetLangByExt(filetype)
+}
+
+// returns language by exact file name, then by its extension
+func (r *LanguageRegistry) GetLangByFilename(filename string) string {
+	if langName, ok := r.langnameByFilename[filename]; ok {
+		return langName
+	}
+
+	return r.GetLangByExt(filepath.Ext(filename))
+}
+
 func (r *LanguageRegistry) GetLineComments(langName string) []string {
 	data, ok := r.langsByName[langName]
 
@@ -73,37 +198,323 @@ func (r *LanguageRegistry) GetBlockComments(langName string) [][]string {
 	return data.BlockComments
 }
 
+// language definitions used when no override path is configured
+//
+//go:embed ple.json
+var defaultLanguages []byte
+
+// parses JSON list of language definitions,
+// unknown fields are rejected to catch typos in keys
+func ParseLanguages(data []byte) ([]LanguageData, error) {
+	langList := []LanguageData{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&langList); err != nil {
+		return nil, fmt.Errorf("invalid language definitions: %w", err)
+	}
+
+	return langList, nil
+}
+
+// builds registry from JSON list of language definitions
+func NewLanguageRegistry(data []byte) (*LanguageRegistry, error) {
+	langList, err := ParseLanguages(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newLanguageRegistry(langList)
+}
+
+func newLanguageRegistry(langList []LanguageData) (*LanguageRegistry, error) {
+	if err := ValidateLanguages(langList); err != nil {
+		return nil, err
+	}
+
+	if err := validateGroups(langList); err != nil {
+		return nil, err
+	}
+
+	r := &LanguageRegistry{
+		langsByName:        make(map[string]*LanguageData, len(langList)),
+		langnameByExt:      make(map[string]string),
+		langnameByFilename: make(map[string]string),
+		langnameByAlias:    make(map[string]string),
+		langnameByInterp:   make(map[string]string),
+	}
+
+	for i := range langList {
+		lang := &langList[i]
+		r.langsByName[lang.Name] = lang
+		r.langnameByAlias[strings.ToLower(lang.Name)] = lang.Name
+
+		for _, alias := range lang.Aliases {
+			r.langnameByAlias[strings.ToLower(alias)] = lang.Name
+		}
+
+		for _, interpreter := range lang.Interpreters {
+			r.langnameByInterp[interpreter] = lang.Name
+		}
+
+		for _, ext := range lang.Extensions {
+			r.langnameByExt[ext] = lang.Name
+		}
+
+		for _, filename := range lang.Filenames {
+			r.langnameByFilename[filename] = lang.Name
+		}
+	}
+
+	return r, nil
+}
+
+// returns new registry with overlay definitions layered on top of r,
+// r itself is not modified.
+//
+// An overlay language replaces the language with the same name,
+// its extensions, filenames and interpreters are taken away from other languages,
+// languages left without any of them are dropped
+func (r *LanguageRegistry) Extend(overlay []LanguageData) (*LanguageRegistry, error) {
+	if len(overlay) == 0 {
+		return r, nil
+	}
+
+	if err := ValidateLanguages(overlay); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(overlay))
+	exts := make(map[string]bool)
+	filenames := make(map[string]bool)
+	interpreters := make(map[string]bool)
+
+	for _, lang := range overlay {
+		names[lang.Name] = true
+
+		for _, interpreter := range lang.Interpreters {
+			interpreters[interpreter] = true
+		}
+
+		for _, ext := range lang.Extensions {
+			exts[ext] = true
+		}
+
+		for _, filename := range lang.Filenames {
+			filenames[filename] = true
+		}
+	}
+
+	langList := make([]LanguageData, 0, len(r.langsByName)+len(overlay))
+
+	for _, data := range r.langsByName {
+		if names[data.Name] {
+			continue
+		}
+
+		lang := *data
+		lang.Extensions = slices.DeleteFunc(slices.Clone(data.Extensions), func(ext string) bool {
+			return exts[ext]
+		})
+		lang.Filenames = slices.DeleteFunc(slices.Clone(data.Filenames), func(filename string) bool {
+			return filenames[filename]
+		})
+		lang.Interpreters = slices.DeleteFunc(slices.Clone(data.Interpreters), func(interpreter string) bool {
+			return interpreters[interpreter]
+		})
+
+		if len(lang.Extensions) == 0 && len(lang.Filenames) == 0 {
+			continue
+		}
+
+		langList = append(langList, lang)
+	}
+
+	return newLanguageRegistry(append(langList, overlay...))
+}
+
+// registry of built-in definitions with the deployment overlay applied
+func DefaultRegistry() *LanguageRegistry {
+	return registry
+}
+
+// reports every problem of the definitions at once
+func ValidateLanguages(langList []LanguageData) error {
+	errs := make([]error, 0)
+	names := make(map[string]bool, len(langList))
+	exts := make(map[string]string)
+	filenames := make(map[string]string)
+	aliases := make(map[string]string, len(langList))
+	interpreters := make(map[string]string)
+
+	// names are reserved before aliases are checked
+	for _, lang := range langList {
+		aliases[strings.ToLower(lang.Name)] = lang.Name
+	}
+
+	for i, lang := range langList {
+		if strings.TrimSpace(lang.Name) == "" {
+			errs = append(errs, fmt.Errorf("language #%d: empty name", i))
+			continue
+		}
+
+		if lang.Name == "Other" {
+			errs = append(errs, fmt.Errorf("language %q: name is reserved for unknown files", lang.Name))
+		}
+
+		if names[lang.Name] {
+			errs = append(errs, fmt.Errorf("language %q: declared more than once", lang.Name))
+		}
+
+		names[lang.Name] = true
+
+		if len(lang.Extensions) == 0 && len(lang.Filenames) == 0 {
+			errs = append(errs, fmt.Errorf("language %q: no extensions or filenames", lang.Name))
+		}
+
+		for _, ext := range lang.Extensions {
+			if ext == "" || strings.HasPrefix(ext, ".") {
+				errs = append(errs, fmt.Errorf("language %q: invalid extension %q, expected without leading dot", lang.Name, ext))
+			} else if other, ok := exts[ext]; ok && other != lang.Name {
+				errs = append(errs, fmt.Errorf("language %q: extension %q is already used by %q", lang.Name, ext, other))
+			}
+
+			exts[ext] = lang.Name
+		}
+
+		for _, filename := range lang.Filenames {
+			if filename == "" || strings.ContainsAny(filename, "/\\") {
+				errs = append(errs, fmt.Errorf("language %q: invalid filename %q", lang.Name, filename))
+			} else if other, ok := filenames[filename]; ok && other != lang.Name {
+				errs = append(errs, fmt.Errorf("language %q: filename %q is already used by %q", lang.Name, filename, other))
+			}
+
+			filenames[filename] = lang.Name
+		}
+
+		for _, comment := range lang.LineComments {
+			if comment == "" {
+				errs = append(errs, fmt.Errorf("language %q: empty line comment", lang.Name))
+			}
+		}
+
+		for _, pair := range lang.BlockComments {
+			if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+				errs = append(errs, fmt.Errorf("language %q: block comment %q must be a pair of start and end markers", lang.Name, pair))
+			}
+		}
+
+		for role := range lang.Roles {
+			if !slices.Contains(Roles, role) || role == ROLE_PRODUCTION {
+				errs = append(errs, fmt.Errorf("language %q: unknown role %q", lang.Name, role))
+			}
+		}
+
+		if lang.Type != "" && !slices.Contains(LanguageTypes, lang.Type) {
+			errs = append(errs, fmt.Errorf("language %q: unknown type %q, expected one of %s", lang.Name, lang.Type, strings.Join(LanguageTypes, ", ")))
+		}
+
+		if lang.Color != "" && !colorRegexp.MatchString(lang.Color) {
+			errs = append(errs, fmt.Errorf("language %q: invalid color %q, expected hex like #00ADD8", lang.Name, lang.Color))
+		}
+
+		for _, alias := range lang.Aliases {
+			key := strings.ToLower(strings.TrimSpace(alias))
+
+			if key == "" {
+				errs = append(errs, fmt.Errorf("language %q: empty alias", lang.Name))
+			} else if other, ok := aliases[key]; ok && other != lang.Name {
+				errs = append(errs, fmt.Errorf("language %q: alias %q is already used by %q", lang.Name, alias, other))
+			}
+
+			aliases[key] = lang.Name
+		}
+
+		for _, interpreter := range lang.Interpreters {
+			if interpreter == "" || strings.ContainsAny(interpreter, "/ ") {
+				errs = append(errs, fmt.Errorf("language %q: invalid interpreter %q, expected base name like python", lang.Name, interpreter))
+			} else if other, ok := interpreters[interpreter]; ok && other != lang.Name {
+				errs = append(errs, fmt.Errorf("language %q: interpreter %q is already used by %q", lang.Name, interpreter, other))
+			}
+
+			interpreters[interpreter] = lang.Name
+		}
+
+		if lang.Group == lang.Name {
+			errs = append(errs, fmt.Errorf("language %q: cannot be grouped into itself", lang.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// groups are checked on the complete list only,
+// overlay languages can be grouped into the base ones
+func validateGroups(langList []LanguageData) error {
+	errs := make([]error, 0)
+	groups := make(map[string]string, len(langList))
+
+	for _, lang := range langList {
+		groups[lang.Name] = lang.Group
+	}
+
+	for _, lang := range langList {
+		if lang.Group == "" {
+			continue
+		}
+
+		parent, ok := groups[lang.Group]
+
+		if !ok {
+			errs = append(errs, fmt.Errorf("language %q: group %q is not a declared language", lang.Name, lang.Group))
+		} else if parent != "" {
+			errs = append(errs, fmt.Errorf("language %q: group %q is grouped itself into %q", lang.Name, lang.Group, parent))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func loadLanguages() ([]byte, error) {
+	if config.Vars.LanguagesPath == "" {
+		return defaultLanguages, nil
+	}
+
+	return os.ReadFile(config.Vars.LanguagesPath)
+}
+
 func initLanguageRegistry() {
-	rootDir, _ := os.Getwd()
+	data, err := loadLanguages()
 
-	if config.Vars.GoEnv == "test" {
-		rootDir = filepath.Join(rootDir, "../../")
+	if err != nil {
+		log.Fatalf("failed to load language definitions: %v", err)
 	}
 
-	jsonFilePath := filepath.Join(rootDir, "ple.json")
-	jsonPLE, err := os.Open(jsonFilePath)
-	defer jsonPLE.Close()
+	registry, err = NewLanguageRegistry(data)
 
 	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+		log.Fatalf("failed to init language registry:\n%v", err)
+	}
+
+	if config.Vars.LanguagesOverlayPath == "" {
 		return
 	}
 
-	byteValue, _ := io.ReadAll(jsonPLE)
-	langList := []LanguageData{}
-	json.Unmarshal(byteValue, &langList)
-	registry = &LanguageRegistry{
-		langsByName:   make(map[string]*LanguageData),
-		langnameByExt: make(map[string]string),
+	data, err = os.ReadFile(config.Vars.LanguagesOverlayPath)
+
+	if err != nil {
+		log.Fatalf("failed to load language overlay: %v", err)
 	}
 
-	for _, entity := range langList {
-		registry.langsByName[entity.Name] = &entity
+	overlay, err := ParseLanguages(data)
 
-		for _, ext := range entity.Extensions {
-			registry.langnameByExt[ext] = entity.Name
-		}
+	if err == nil {
+		registry, err = registry.Extend(overlay)
+	}
+
+	if err != nil {
+		log.Fatalf("failed to apply language overlay %s:\n%v", config.Vars.LanguagesOverlayPath, err)
 	}
 }
 
@@ -2,6 +2,8 @@ package analyzer
 
 import (
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -68,3 +70,221 @@ func TestGetBlockMarkers(t *testing.T) {
 		})
 	}
 }
+
+func TestGetLangByFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"Makefile", "Makefile"},
+		{"CMakeLists.txt", "CMake"},
+		{"notes.txt", "Plain Text"},
+		{"main.go", "Go"},
+		{"LICENSE", "Other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := registry.GetLangByFilename(tt.filename); got != tt.want {
+				t.Errorf("GetLangByFilename(%q) = %q; want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLanguageRegistry(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		errs []string
+	}{
+		{
+			"valid",
+			`[{"name": "Go", "extensions": ["go"], "lineComment": ["//"], "blockComment": [["/*", "*/"]]}]`,
+			nil,
+		},
+		{
+			"unknown field",
+			`[{"name": "QML", "extensions ": ["qml"]}]`,
+			[]string{"unknown field"},
+		},
+		{
+			"empty name",
+			`[{"name": " ", "extensions": ["x"]}]`,
+			[]string{"language #0: empty name"},
+		},
+		{
+			"duplicate extension",
+			`[{"name": "C", "extensions": ["h"]}, {"name": "C Header", "extensions": ["h"]}]`,
+			[]string{`extension "h" is already used by "C"`},
+		},
+		{
+			"conflicting filename",
+			`[{"name": "A", "filenames": ["BUILD"]}, {"name": "B", "filenames": ["BUILD"]}]`,
+			[]string{`filename "BUILD" is already used by "A"`},
+		},
+		{
+			"metadata",
+			`[{"name": "A", "extensions": ["a"], "type": "code", "color": "red", "aliases": ["b"]}, {"name": "B", "extensions": ["b"]}]`,
+			[]string{`unknown type "code"`, `invalid color "red"`, `alias "b" is already used by "B"`},
+		},
+		{
+			"unknown group",
+			`[{"name": "A", "extensions": ["a"], "group": "B"}]`,
+			[]string{`group "B" is not a declared language`},
+		},
+		{
+			"all problems at once",
+			`[{"name": "A", "extensions": [".a"], "blockComment": [["/*"]], "roles": {"unit": ["*"]}}]`,
+			[]string{"invalid extension", "block comment", `unknown role "unit"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLanguageRegistry([]byte(tt.data))
+
+			if tt.errs == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected error")
+			}
+
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestExtendRegistry(t *testing.T) {
+	overlay, err := ParseLanguages([]byte(`[
+		{"name": "Terraform DSL", "extensions": ["tfx", "tf"], "lineComment": ["#"], "blockComment": []},
+		{"name": "Go", "extensions": ["go"], "lineComment": ["#"], "blockComment": []}
+	]`))
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	extended, err := registry.Extend(overlay)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	tests := []struct {
+		ext  string
+		want string
+	}{
+		{"tfx", "Terraform DSL"},
+		{"tf", "Terraform DSL"},
+		{"go", "Go"},
+		{"py", "Python"},
+	}
+
+	for _, tt := range tests {
+		if got := extended.GetLangByExt(tt.ext); got != tt.want {
+			t.Errorf("GetLangByExt(%q) = %q; want %q", tt.ext, got, tt.want)
+		}
+	}
+
+	if got := extended.GetLineComments("Go"); !reflect.DeepEqual(got, []string{"#"}) {
+		t.Errorf("Expected Go definition to be replaced, got %q", got)
+	}
+
+	// HCL has no extensions left
+	if slices.Contains(extended.GetLangs(), "HCL") {
+		t.Errorf("Expected HCL to be dropped")
+	}
+
+	// base registry stays untouched
+	if registry.GetLangByExt("tf") != "HCL" || !reflect.DeepEqual(registry.GetLineComments("Go"), []string{"//"}) {
+		t.Errorf("Base registry was modified")
+	}
+
+	if _, err := registry.Extend([]LanguageData{{Name: "Bad"}}); err == nil {
+		t.Errorf("Expected invalid overlay to fail")
+	}
+}
+
+func TestLanguageMetadata(t *testing.T) {
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"golang", "Go"},
+		{"GO", "Go"},
+		{"js", "JavaScript"},
+		{"c++", "C++"},
+		{"cpp", "C++"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			data, ok := registry.FindLanguage(tt.alias)
+
+			if !ok || data.Name != tt.want {
+				t.Errorf("FindLanguage(%q) = %v; want %q", tt.alias, data, tt.want)
+			}
+		})
+	}
+
+	if _, ok := registry.FindLanguage("unknown"); ok {
+		t.Errorf("Expected unknown alias not to be found")
+	}
+
+	if got := registry.GetGroup("JSX"); got != "JavaScript" {
+		t.Errorf("GetGroup(JSX) = %q; want JavaScript", got)
+	}
+
+	if got := registry.GetGroup("Go"); got != "Go" {
+		t.Errorf("GetGroup(Go) = %q; want Go", got)
+	}
+
+	if data, _ := registry.GetLanguage("Go"); data.Type != LANG_TYPE_PROGRAMMING || data.Color != "#00ADD8" {
+		t.Errorf("Unexpected Go metadata %v", data)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		filename string
+		head     string
+		want     string
+	}{
+		{"src/main.go", "", "Go"},
+		{"build/Makefile", "", "Makefile"},
+		{"bin/run", "#!/usr/bin/env ruby\n", "Ruby"},
+		{"Brewfile", "# vim: ft=ruby\n", "Ruby"},
+		{"main.ts", "#!/usr/bin/env node\n", "TypeScript"},
+		{"notes", "", "Other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := registry.Detect(tt.filename, []byte(tt.head)); got != tt.want {
+				t.Errorf("Detect(%q) = %q; want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+
+	langs := registry.Languages()
+
+	if len(langs) != len(registry.GetLangs()) {
+		t.Fatalf("Expected all languages, got %d", len(langs))
+	}
+
+	if !slices.IsSortedFunc(langs, func(a, b *LanguageData) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	}) {
+		t.Errorf("Expected languages to be sorted by name")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,15 @@ func (this *FileTask) Process() {
 type Options struct {
 	ExcludeFilePatterns []string
 	ExcludeDirPatterns  []string
+	DetectDuplicates    bool     // run duplicate code detection pass
+	ScanMarkers         bool     // run TODO/FIXME marker scan over comments
+	MarkerTags          []string // custom marker tags added to the default ones
+	GroupLanguages      bool     // collapse languages into their groups, e.g. JSX into JavaScript
+	LanguageTypes       []string // keep only languages of these types, all if empty
+
+	// languages to detect, DefaultRegistry is used if nil,
+	// it is not serialized with the options
+	Registry *LanguageRegistry `json:"-"`
 }
 
 var defaultOptions = &Options{
@@ -66,11 +76,17 @@ var defaultOptions = &Options{
 }
 
 type Result struct {
-	TotalFiles    int32       `json:"total_files"`
-	TotalLines    int32       `json:"total_lines"`
-	TotalBlank    int32       `json:"total_blank"`
-	TotalComments int32       `json:"total_comments"`
-	Languages     []*Language `json:"languages"`
+	TotalFiles    int32           `json:"total_files"`
+	TotalLines    int32           `json:"total_lines"`
+	TotalBlank    int32           `json:"total_blank"`
+	TotalComments int32           `json:"total_comments"`
+	Languages     []*Language     `json:"languages"`
+	Roles         []*LanguageRole `json:"roles"`      // totals by file role
+	TestRatio     float64         `json:"test_ratio"` // test lines per production line
+	Duplication   *Duplication    `json:"duplication,omitempty"`
+	Markers       *Markers        `json:"markers,omitempty"`
+	License       *License        `json:"license"`
+	Dependencies  []*Ecosystem    `json:"dependencies"`
 }
 
 type RepoAnalyzer struct {
@@ -79,7 +95,13 @@ type RepoAnalyzer struct {
 	cancel    context.CancelFunc
 	parallel  bool
 	opts      *Options
+	registry  *LanguageRegistry
 	languages map[string]*Language
+	root      string               // root directory of the analyzed repository
+	dups      *DuplicationDetector // nil if duplicate detection is disabled
+	markers   *MarkerScanner       // nil if marker scan is disabled
+	license   *LicenseDetector
+	deps      *DependencyScanner
 }
 
 func New(opts *Options) *RepoAnalyzer {
@@ -87,9 +109,26 @@ func New(opts *Options) *RepoAnalyzer {
 	opts.ExcludeDirPatterns = append(opts.ExcludeDirPatterns, defaultOptions.ExcludeDirPatterns...)
 	opts.ExcludeFilePatterns = append(opts.ExcludeFilePatterns, defaultOptions.ExcludeFilePatterns...)
 
+	langRegistry := opts.Registry
+
+	if langRegistry == nil {
+		langRegistry = registry
+	}
+
 	analyzer := &RepoAnalyzer{
-		languages: DefinedLanguages(),
+		registry:  langRegistry,
+		languages: langRegistry.DefinedLanguages(),
 		opts:      opts,
+		license:   NewLicenseDetector(),
+		deps:      NewDependencyScanner(),
+	}
+
+	if opts.DetectDuplicates {
+		analyzer.dups = NewDuplicationDetector()
+	}
+
+	if opts.ScanMarkers {
+		analyzer.markers = NewMarkerScanner(opts.MarkerTags)
 	}
 
 	return analyzer
@@ -101,24 +140,71 @@ func (this *RepoAnalyzer) Result() *Result {
 	total := NewLanguage("TOTAL")
 
 	for _, lang := range this.languages {
-		// ignore Total and empty languages
-		if lang.Files > 0 && lang.Name != "TOTAL" {
-			total.Files += lang.Files
-			total.Blank += lang.Blank
-			total.Lines += lang.Lines
-			total.Comments += lang.Comments
+		// ignore Total, empty and filtered out languages
+		if lang.Files > 0 && lang.Name != "TOTAL" && this.matchType(lang) {
 			langs = append(langs, lang)
 		}
 	}
 
+	if this.opts.GroupLanguages {
+		langs = this.groupLanguages(langs)
+	}
+
+	for _, lang := range langs {
+		total.Files += lang.Files
+		total.Blank += lang.Blank
+		total.Lines += lang.Lines
+		total.Comments += lang.Comments
+	}
+
+	roles := make([]*LanguageRole, 0, len(Roles))
+
+	for _, lang := range langs {
+		lang.Roles = make([]*LanguageRole, 0)
+
+		for _, role := range Roles {
+			if counter := lang.roles[role]; counter.Files > 0 {
+				lang.Roles = append(lang.Roles, counter)
+
+				totalRole := total.roles[role]
+				totalRole.Files += counter.Files
+				totalRole.Lines += counter.Lines
+				totalRole.Blank += counter.Blank
+				totalRole.Comments += counter.Comments
+			}
+		}
+	}
+
+	for _, role := range Roles {
+		if counter := total.roles[role]; counter.Files > 0 {
+			roles = append(roles, counter)
+		}
+	}
+
 	result := &Result{
 		TotalFiles:    total.Files,
 		TotalLines:    total.Lines,
 		TotalBlank:    total.Blank,
 		TotalComments: total.Comments,
 		Languages:     langs,
+		Roles:         roles,
+	}
+
+	if production := total.roles[ROLE_PRODUCTION].Lines; production > 0 {
+		result.TestRatio = float64(total.roles[ROLE_TEST].Lines) / float64(production)
+	}
+
+	if this.dups != nil {
+		result.Duplication = this.dups.Result()
+	}
+
+	if this.markers != nil {
+		result.Markers = this.markers.Result()
 	}
 
+	result.License = this.license.Result()
+	result.Dependencies = this.deps.Result()
+
 	// sort by lines,
 	// if lines are equal, sort by name,
 	sort.SliceStable(result.Languages, func(i, j int) bool {
@@ -134,22 +220,158 @@ func (this *RepoAnalyzer) Result() *Result {
 	return result
 }
 
+func (this *RepoAnalyzer) matchType(lang *Language) bool {
+	return len(this.opts.LanguageTypes) == 0 || slices.Contains(this.opts.LanguageTypes, lang.Type)
+}
+
+// merge languages of the same group into new counters,
+// the analyzer counters stay untouched so Result can be called again
+func (this *RepoAnalyzer) groupLanguages(langs []*Language) []*Language {
+	groups := make(map[string]*Language, len(langs))
+	grouped := make([]*Language, 0, len(langs))
+
+	for _, lang := range langs {
+		name := this.registry.GetGroup(lang.Name)
+		group, ok := groups[name]
+
+		if !ok {
+			group = this.registry.NewLanguage(name)
+			groups[name] = group
+			grouped = append(grouped, group)
+		}
+
+		group.Files += lang.Files
+		group.Lines += lang.Lines
+		group.Blank += lang.Blank
+		group.Comments += lang.Comments
+
+		for role, counter := range lang.roles {
+			groupRole := group.roles[role]
+			groupRole.Files += counter.Files
+			groupRole.Lines += counter.Lines
+			groupRole.Blank += counter.Blank
+			groupRole.Comments += counter.Comments
+		}
+	}
+
+	return grouped
+}
+
+// path of the file relative to the root of the analyzed repository
+func (this *RepoAnalyzer) relPath(path string) string {
+	rel, err := filepath.Rel(this.root, path)
+
+	if err != nil {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
 func (this *RepoAnalyzer) AnalyzeFile(path string) {
-	result := Reader(path)
+	var (
+		visitors  []LineVisitor
+		codeLines []codeLine
+		markers   []*MarkerOccurrence
+		spdx      string
+	)
+
+	visitors = append(visitors, func(line *Line) {
+		if spdx != "" || line.Number > LICENSE_HEADER_LINES {
+			return
+		}
+
+		if expr, ok := ParseSPDXHeader(line.Text); ok {
+			spdx = expr
+		}
+	})
+
+	if this.dups != nil {
+		visitors = append(visitors, func(line *Line) {
+			if line.Kind != LINE_CODE {
+				return
+			}
+
+			if hash, ok := hashCodeLine(line.Text); ok {
+				codeLines = append(codeLines, codeLine{number: line.Number, hash: hash})
+			}
+		})
+	}
+
+	if this.markers != nil {
+		visitors = append(visitors, func(line *Line) {
+			if line.Kind != LINE_COMMENT {
+				return
+			}
+
+			if tag, ok := this.markers.Match(line.Text); ok {
+				markers = append(markers, &MarkerOccurrence{Tag: tag, Line: line.Number, Text: line.Text})
+			}
+		})
+	}
+
+	result := this.registry.ReadFile(path, chainVisitors(visitors))
+	rel := this.relPath(path)
+
+	if this.dups != nil && result.Files > 0 {
+		this.dups.Add(rel, result.Name, codeLines)
+	}
+
+	if spdx != "" {
+		this.license.AddHeader(spdx)
+	}
+
+	this.deps.Scan(path, rel)
+
+	if this.markers != nil {
+		for _, occ := range markers {
+			occ.Path = rel
+			occ.Language = result.Name
+		}
+
+		this.markers.Add(markers)
+	}
 
 	lang := this.languages[result.Name]
 	atomic.AddInt32(&lang.Files, result.Files)
 	atomic.AddInt32(&lang.Lines, result.Lines)
 	atomic.AddInt32(&lang.Blank, result.Blank)
 	atomic.AddInt32(&lang.Comments, result.Comments)
+
+	role := lang.roles[this.registry.GetRole(result.Name, rel)]
+	atomic.AddInt32(&role.Files, result.Files)
+	atomic.AddInt32(&role.Lines, result.Lines)
+	atomic.AddInt32(&role.Blank, result.Blank)
+	atomic.AddInt32(&role.Comments, result.Comments)
+}
+
+// combine several line visitors into one, returns nil if there are no visitors
+func chainVisitors(visitors []LineVisitor) LineVisitor {
+	if len(visitors) == 0 {
+		return nil
+	}
+
+	return func(line *Line) {
+		for _, visit := range visitors {
+			visit(line)
+		}
+	}
 }
 
 func (this *RepoAnalyzer) Do(path string, parallelMode bool) (*Result, time.Duration, error) {
+	return this.DoContext(context.Background(), path, parallelMode)
+}
+
+// DoContext is like Do, but the walk stops with ctx error once ctx is done
+func (this *RepoAnalyzer) DoContext(ctx context.Context, path string, parallelMode bool) (*Result, time.Duration, error) {
 	wg := &sync.WaitGroup{}
+	this.root = path
+	this.license.ScanRoot(path)
+
 	if parallelMode {
 
 		this.tasks = make(chan *FileTask, 100)
-		this.ctx, this.cancel = context.WithCancel(context.Background())
+		this.ctx, this.cancel = context.WithCancel(ctx)
 		defer this.cancel()
 
 		for range runtime.NumCPU() {
@@ -164,6 +386,10 @@ func (this *RepoAnalyzer) Do(path string, parallelMode bool) (*Result, time.Dura
 			return err
 		}
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		name := info.Name()
 
 		if info.IsDir() {
@@ -192,11 +418,14 @@ func (this *RepoAnalyzer) Do(path string, parallelMode bool) (*Result, time.Dura
 				Wg:       wg,
 			}
 
+			// added before the send, a worker may be done with the task before the send returns
+			wg.Add(1)
+
 			select {
 			case this.tasks <- task:
-				wg.Add(1)
 				return nil
 			default:
+				wg.Done()
 				this.AnalyzeFile(path)
 				return nil
 			}
@@ -207,26 +436,27 @@ func (this *RepoAnalyzer) Do(path string, parallelMode bool) (*Result, time.Dura
 		return nil
 	})
 
-	wg.Wait()
-
-	analyzeTimeEnd := time.Since(analyzeTimeStart)
-
+	// workers drain the queued tasks until the channel is closed, so none is left undone
 	if parallelMode {
 		close(this.tasks)
 	}
 
+	wg.Wait()
+
+	analyzeTimeEnd := time.Since(analyzeTimeStart)
+
 	return this.Result(), analyzeTimeEnd, err
 }
 
+// FileWorker processes the tasks until the channel is closed,
+// once done is done the remaining tasks are skipped but still marked as done
 func FileWorker(tasks <-chan *FileTask, done context.Context) {
-	for {
-		select {
-		case task := <-tasks:
-			if task != nil {
-				task.Process()
-			}
-		case <-done.Done():
-			return
+	for task := range tasks {
+		if done.Err() != nil {
+			task.Wg.Done()
+			continue
 		}
+
+		task.Process()
 	}
 }
@@ -1,9 +1,13 @@
 package analyzer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -190,3 +194,118 @@ func TestAnalyzeRepositorySync(t *testing.T) {
 		t.Errorf("Expected 3 languages, got %d", len(result.Languages))
 	}
 }
+
+func TestAnalyzeWithCustomRegistry(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(dir+"/rules.dsl", []byte("; comment\nrule a\nrule b\n"), 0644)
+
+	langRegistry, err := registry.Extend([]LanguageData{
+		{Name: "Rules", Extensions: []string{"dsl"}, LineComments: []string{";"}},
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	analyzer := New(&Options{Registry: langRegistry})
+	result, _, _ := analyzer.Do(dir, false)
+
+	if len(result.Languages) != 1 || result.Languages[0].Name != "Rules" {
+		t.Fatalf("Expected Rules language, got %v", result.Languages)
+	}
+
+	if result.Languages[0].Comments != 1 {
+		t.Errorf("Expected 1 comment, got %d", result.Languages[0].Comments)
+	}
+}
+
+func TestAnalyzeGroupAndFilterLanguages(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(dir+"/main.c", []byte("int main() {}\n"), 0644)
+	os.WriteFile(dir+"/main.h", []byte("int main();\n\n"), 0644)
+	os.WriteFile(dir+"/README.md", []byte("# readme\n"), 0644)
+
+	result, _, _ := New(&Options{GroupLanguages: true}).Do(dir, false)
+	names := make(map[string]int32)
+
+	for _, lang := range result.Languages {
+		names[lang.Name] = lang.Lines
+	}
+
+	if len(names) != 2 || names["C"] != 3 || names["Markdown"] != 1 {
+		t.Errorf("Expected C Header to be grouped into C, got %v", names)
+	}
+
+	result, _, _ = New(&Options{LanguageTypes: []string{LANG_TYPE_PROGRAMMING}}).Do(dir, false)
+
+	if len(result.Languages) != 2 || result.TotalLines != 3 {
+		t.Errorf("Expected only C and C Header with 3 lines, got %d languages and %d lines", len(result.Languages), result.TotalLines)
+	}
+}
+
+func TestAnalyzeCanceled(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(dir+"/main.go", []byte("package main\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := New(&Options{}).DoContext(ctx, dir, true)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// context canceled once its error was checked the given number of times
+type cancelAfterChecks struct {
+	context.Context
+	checks atomic.Int32
+	limit  int32
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfterChecks) Err() error {
+	if c.checks.Add(1) == c.limit {
+		c.cancel()
+	}
+
+	return c.Context.Err()
+}
+
+func TestAnalyzeCanceledDuringWalk(t *testing.T) {
+	dir := t.TempDir()
+
+	// files over 20KB are queued to the file workers
+	content := []byte(strings.Repeat("var x = 1 // comment\n", 1500))
+
+	for i := range 500 {
+		os.WriteFile(fmt.Sprintf("%s/file%d.go", dir, i), content, 0644)
+	}
+
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx := &cancelAfterChecks{Context: base, limit: 250, cancel: cancel}
+	done := make(chan error)
+
+	go func() {
+		_, _, err := New(&Options{}).DoContext(ctx, dir, true)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Analysis canceled during the walk did not return")
+	}
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// File roles, the order is the precedence of matching:
+// a test inside examples/ dir is still a test
+const (
+	ROLE_TEST          = "test"
+	ROLE_EXAMPLE       = "example"
+	ROLE_DOCUMENTATION = "documentation"
+	ROLE_BUILD         = "build"
+	ROLE_PRODUCTION    = "production"
+)
+
+var Roles = []string{ROLE_TEST, ROLE_EXAMPLE, ROLE_DOCUMENTATION, ROLE_BUILD, ROLE_PRODUCTION}
+
+// path conventions shared by all languages,
+// language specific ones are declared in ple.json
+//
+// "name/" matches any directory in the path,
+// other patterns are matched against the file name
+var defaultRolePatterns = map[string][]string{
+	ROLE_TEST:          {"test/", "tests/", "__tests__/", "spec/", "testdata/", "__mocks__/"},
+	ROLE_EXAMPLE:       {"example/", "examples/", "sample/", "samples/", "demo/", "demos/"},
+	ROLE_DOCUMENTATION: {"doc/", "docs/", "documentation/", "README*", "CHANGELOG*", "CONTRIBUTING*"},
+	ROLE_BUILD:         {".github/", ".circleci/", ".gitlab/", "Dockerfile*", "docker-compose*", "*.gradle", "*.gradle.kts"},
+}
+
+type LanguageRole struct {
+	Role     string `json:"role" redis:"role"`
+	Files    int32  `json:"files" redis:"files"`
+	Lines    int32  `json:"lines" redis:"lines"`
+	Blank    int32  `json:"blank" redis:"blank"`
+	Comments int32  `json:"comments" redis:"comments"`
+}
+
+func matchRolePattern(pattern, path string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		segments := strings.Split(path, "/")
+
+		for _, segment := range segments[:len(segments)-1] {
+			if strings.EqualFold(segment, dir) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	matched, _ := filepath.Match(pattern, filepath.Base(path))
+
+	return matched
+}
+
+// returns role of the file by its slash separated path relative to the repository root
+func (r *LanguageRegistry) GetRole(langName, path string) string {
+	var langPatterns map[string][]string
+
+	if data, ok := r.langsByName[langName]; ok {
+		langPatterns = data.Roles
+	}
+
+	for _, role := range Roles {
+		for _, pattern := range langPatterns[role] {
+			if matchRolePattern(pattern, path) {
+				return role
+			}
+		}
+
+		for _, pattern := range defaultRolePatterns[role] {
+			if matchRolePattern(pattern, path) {
+				return role
+			}
+		}
+	}
+
+	return ROLE_PRODUCTION
+}
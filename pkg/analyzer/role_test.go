@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetRole(t *testing.T) {
+	tests := []struct {
+		lang string
+		path string
+		want string
+	}{
+		{"Go", "pkg/analyzer/file.go", ROLE_PRODUCTION},
+		{"Go", "pkg/analyzer/file_test.go", ROLE_TEST},
+		{"Go", "examples/basic/main.go", ROLE_EXAMPLE},
+		{"Go", "examples/basic/main_test.go", ROLE_TEST},
+		{"Go", "testdata/fixture.go", ROLE_TEST},
+		{"JavaScript", "src/app.spec.js", ROLE_TEST},
+		{"JavaScript", "src/__tests__/app.js", ROLE_TEST},
+		{"Python", "pkg/test_utils.py", ROLE_TEST},
+		{"Markdown", "README.md", ROLE_DOCUMENTATION},
+		{"Go", "docs/gen.go", ROLE_DOCUMENTATION},
+		{"YAML", ".github/workflows/ci.yml", ROLE_BUILD},
+		{"Unknown", "Tests/file.txt", ROLE_TEST},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := registry.GetRole(tt.lang, tt.path); got != tt.want {
+				t.Errorf("GetRole(%q, %q) = %q; want %q", tt.lang, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeRoles(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main_test.go"), []byte("package main\n"), 0644)
+
+	analyzer := New(&Options{})
+	result, _, _ := analyzer.Do(dir, false)
+
+	counts := make(map[string]int32)
+
+	for _, role := range result.Roles {
+		counts[role.Role] = role.Lines
+	}
+
+	if counts[ROLE_PRODUCTION] != 4 || counts[ROLE_TEST] != 1 {
+		t.Errorf("Unexpected role lines %v", counts)
+	}
+
+	if result.TestRatio != 0.25 {
+		t.Errorf("Expected test ratio 0.25, got %v", result.TestRatio)
+	}
+
+	goLang := result.Languages[0]
+
+	if len(goLang.Roles) != 2 {
+		t.Errorf("Expected Go to have 2 roles, got %d", len(goLang.Roles))
+	}
+}
@@ -25,7 +25,7 @@ func NewAnalyzeError(statusCode int, message string) *AnalyzeError {
 
 type TaskStatusError struct {
 	StatusCode int
-	Task       *tasks.RepoTask
+	Task       *tasks.TaskSnapshot
 	Message    string
 }
 
@@ -33,7 +33,7 @@ func (e *TaskStatusError) Error() string {
 	return e.Message
 }
 
-func NewTaskStatusError(task *tasks.RepoTask, statusCode int, message string) *TaskStatusError {
+func NewTaskStatusError(task *tasks.TaskSnapshot, statusCode int, message string) *TaskStatusError {
 	return &TaskStatusError{
 		StatusCode: statusCode,
 		Task:       task,
@@ -58,15 +58,16 @@ func ErrorHandlerForAnalysingRoutes() gin.HandlerFunc {
 			case *TaskStatusError:
 				if e.Task != nil {
 					c.JSON(e.StatusCode, TaskInfo{
-						Status:       e.Task.Status,
-						Done:         e.Task.Status == tasks.STATUS_DONE,
+						Status:       e.Task.State,
+						Done:         e.Task.Finished(),
 						Error:        true,
 						ErrorMessage: e.Error(),
+						ErrorCode:    tasks.ErrorCodeOf(e.Task.Err),
 						Result:       nil,
 					})
 				} else {
 					c.JSON(e.StatusCode, TaskInfo{
-						Status:       tasks.STATUS_DONE,
+						Status:       tasks.STATE_FAILED,
 						Done:         true,
 						Error:        true,
 						ErrorMessage: e.Error(),
@@ -1,37 +1,45 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"git-analyzer/pkg/analyzer"
 	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/providers"
 	"git-analyzer/pkg/tasks"
+	"math"
 	"net/http"
-	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/go-github/v63/github"
-)
-
-var (
-	githubClient = github.NewClient(nil).WithAuthToken(config.Vars.GithubApiPat)
-	githubRegexp = regexp.MustCompile(`^/([^/]+)/([^/]+)(?:/|$)`)
 )
 
 type ResponseData struct {
-	RepoSizeLimit   int64                `redis:"repo_size_limit" json:"repo_size_limit"`
-	IsProd          bool                 `redis:"is_prod" json:"is_prod"`
-	ParallelMode    bool                 `redis:"parallel_mode" json:"parallel_mode"`
-	Languages       []*analyzer.Language `redis:"languages" json:"languages"`
-	TotalLines      int32                `redis:"total_lines" json:"total_lines"`
-	TotalFiles      int32                `redis:"total_files" json:"total_files"`
-	TotalBlank      int32                `redis:"total_blank" json:"total_blank"`
-	TotalComments   int32                `redis:"total_comments" json:"total_comments"`
-	FetchSpeed      time.Duration        `redis:"fetch_speed" json:"fetch_speed"`
-	AnalysisSpeed   time.Duration        `redis:"analysis_speed" json:"analysis_speed"`
-	FetchSpeedStr   string               `redis:"fetch_speed_str" json:"fetch_speed_str"`
-	AnalysisSpeeStr string               `redis:"analysis_speed_str" json:"analysis_speed_str"`
-	Error           string               `redis:"error" json:"error"`
+	RepoSizeLimit   int64                    `redis:"repo_size_limit" json:"repo_size_limit"`
+	IsProd          bool                     `redis:"is_prod" json:"is_prod"`
+	ParallelMode    bool                     `redis:"parallel_mode" json:"parallel_mode"`
+	Languages       []*analyzer.Language     `redis:"languages" json:"languages"`
+	Dependencies    []*analyzer.Ecosystem    `redis:"dependencies" json:"dependencies"`
+	Roles           []*analyzer.LanguageRole `redis:"roles" json:"roles"`
+	TestRatio       float64                  `redis:"test_ratio" json:"test_ratio"`
+	TotalLines      int32                    `redis:"total_lines" json:"total_lines"`
+	TotalFiles      int32                    `redis:"total_files" json:"total_files"`
+	TotalBlank      int32                    `redis:"total_blank" json:"total_blank"`
+	TotalComments   int32                    `redis:"total_comments" json:"total_comments"`
+	FetchSpeed      time.Duration            `redis:"fetch_speed" json:"fetch_speed"`
+	AnalysisSpeed   time.Duration            `redis:"analysis_speed" json:"analysis_speed"`
+	FetchSpeedStr   string                   `redis:"fetch_speed_str" json:"fetch_speed_str"`
+	AnalysisSpeeStr string                   `redis:"analysis_speed_str" json:"analysis_speed_str"`
+	Error           string                   `redis:"error" json:"error"`
+	Duplication     *analyzer.Duplication    `redis:"duplication" json:"duplication"`
+	Markers         *analyzer.Markers        `redis:"markers" json:"markers"`
+	License         *analyzer.License        `redis:"license" json:"license"`
+	Ref             string                   `redis:"ref" json:"ref"`       // analyzed branch, tag or commit
+	Commit          string                   `redis:"commit" json:"commit"` // SHA of the analyzed commit
+	TaskID          string                   `redis:"-" json:"task_id"`     // empty for cached results
 }
 
 // GET /
@@ -46,55 +54,109 @@ func HandleGetForm(s *Server) func(*gin.Context) {
 }
 
 type TaskInit struct {
-	ID           string `json:"id"`
-	Error        bool   `json:"error"`
-	ErrorMessage string `json:"error_message"`
-	Cache        bool   `json:"cache"`
-	CacheKey     string `json:"cache_key"`
-	Position     int    `json:"position"`
+	ID            string  `json:"id"`
+	Error         bool    `json:"error"`
+	ErrorMessage  string  `json:"error_message"`
+	Cache         bool    `json:"cache"`
+	CacheKey      string  `json:"cache_key"`
+	Position      int     `json:"position"`       // 0 if the task is not queued anymore
+	Ahead         int     `json:"ahead"`          // queued tasks ahead
+	EstimatedWait float64 `json:"estimated_wait"` // seconds until the task is done
 }
 
 // POST /api
 func HandleCreateTask(s *Server) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		rOwnerRaw, _ := c.Get("repo_owner")
-		rNameRaw, _ := c.Get("repo_name")
-		rOwner := rOwnerRaw.(string)
-		rName := rNameRaw.(string)
+		repo := getRepo(c)
 
-		repoSize, err := fetchRepoSize(rOwner, rName)
+		client, authenticated, err := getClient(c)
 
 		if err != nil {
-			c.Error(NewAnalyzeError(http.StatusNotFound, err.Error()))
+			c.Error(NewAnalyzeError(http.StatusUnauthorized, err.Error()))
+			return
+		}
+
+		token := getAccessToken(c)
+
+		// the server token may see private repositories, they are analyzed only for users who can see them too
+		if repo.Private && token == "" {
+			c.Error(NewAnalyzeError(http.StatusForbidden, "Repository is private, an access token is required to analyze it"))
 			return
 		}
 
-		if repoSize > tasks.RepoTaskQueue.MaxRepoSize {
-			msg := fmt.Sprintf("Repository size is too large <strong>%d MB</strong>", repoSize/(1024*1024))
+		if repo.Size > tasks.RepoTaskQueue.MaxRepoSize {
+			msg := fmt.Sprintf("Repository size is too large <strong>%d MB</strong>", repo.Size/(1024*1024))
 			c.Error(NewAnalyzeError(http.StatusBadRequest, msg))
 			return
 		}
 
+		repoSize := tasks.RepoTaskQueue.ExpectedSize(repo.Size)
+
+		languages, langRegistry, err := getLanguageRegistry(c)
+
+		if err != nil {
+			c.Error(NewAnalyzeError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		opts := getOptions(c)
+		opts.Registry = langRegistry
+
+		for _, langType := range opts.LanguageTypes {
+			if !slices.Contains(analyzer.LanguageTypes, langType) {
+				c.Error(NewAnalyzeError(http.StatusBadRequest, fmt.Sprintf("Unknown language type %q", langType)))
+				return
+			}
+		}
+
 		repoTask := &tasks.RepoTask{
-			Status: tasks.STATUS_INIT,
-			Size:   repoSize,
-			Owner:  rOwner,
-			Name:   rName,
-			Opts: &analyzer.Options{
-				ExcludeFilePatterns: c.PostFormArray("exclude_file_patterns[]"),
-				ExcludeDirPatterns:  c.PostFormArray("exclude_dir_patterns[]"),
-			},
+			Size:       repo.Size,
+			Owner:      repo.Owner,
+			Name:       repo.Name,
+			URL:        repo.CloneURL,
+			Ref:        getRef(c),
+			Private:    repo.Private,
+			PublicOnly: repo.PublicOnly,
+			Languages:  languages,
+			Client:     client,
+			// scheduled refreshes can ask for the low priority to not delay interactive requests
+			Priority: tasks.Classify(repoSize, authenticated, c.PostForm("priority") == "low"),
+			Opts:     opts,
+		}
+
+		// public repositories are cloned anonymously, the token is not kept for them
+		if repo.Private {
+			repoTask.UseToken(repo.Provider.TokenUser(), token)
+		}
+
+		taskID, err := tasks.RepoTaskQueue.Add(repoTask)
+
+		if err != nil {
+			statusCode := http.StatusServiceUnavailable
+
+			if errors.Is(err, tasks.ErrClientQueueFull) {
+				statusCode = http.StatusTooManyRequests
+			}
+
+			retryAfter := tasks.RepoTaskQueue.RetryAfter()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.Error(NewAnalyzeError(statusCode, err.Error()))
+			return
 		}
 
-		taskID := tasks.RepoTaskQueue.Add(repoTask)
+		// identical requests share one task
+		task, _ := tasks.RepoTaskQueue.GetTask(taskID)
+		info := tasks.RepoTaskQueue.Info(task)
 
 		c.JSON(http.StatusAccepted, TaskInit{
-			ID:           taskID,
-			Error:        false,
-			ErrorMessage: "",
-			Cache:        false,
-			CacheKey:     "",
-			Position:     -1,
+			ID:            taskID,
+			Error:         false,
+			ErrorMessage:  "",
+			Cache:         false,
+			CacheKey:      "",
+			Position:      info.Position,
+			Ahead:         info.Ahead,
+			EstimatedWait: info.Wait.Seconds(),
 		})
 	}
 }
@@ -102,14 +164,19 @@ func HandleCreateTask(s *Server) func(c *gin.Context) {
 const (
 	ACTION_STATUS = "0"
 	ACTION_RESULT = "1"
+	ACTION_EXPORT = "2" // markers of the result as CSV, for download links that can not set Accept
 )
 
 type TaskInfo struct {
-	Status       uint8         `json:"task_status"`
-	Done         bool          `json:"task_done"`
-	Error        bool          `json:"task_error"`
-	ErrorMessage string        `json:"task_error_message"`
-	Result       *ResponseData `json:"task_result"`
+	Status        tasks.TaskState `json:"task_status"`
+	Done          bool            `json:"task_done"`
+	Error         bool            `json:"task_error"`
+	ErrorMessage  string          `json:"task_error_message"`
+	ErrorCode     tasks.ErrorCode `json:"task_error_code"`     // empty if there is no error
+	Position      int             `json:"task_position"`       // 0 if the task is not queued
+	Ahead         int             `json:"task_ahead"`          // queued tasks ahead
+	EstimatedWait float64         `json:"task_estimated_wait"` // seconds until the task is done
+	Result        *ResponseData   `json:"task_result"`
 }
 
 // GET /api/task/:id/:action
@@ -118,7 +185,9 @@ func HandleTask(s *Server) func(c *gin.Context) {
 		id := c.Param("id")
 		action := c.Param("action")
 
-		task, ok := tasks.RepoTaskQueue.GetTask(id)
+		// the worker changes the task concurrently, only the snapshot is read,
+		// finished tasks no longer in memory are read from the store
+		snapshot, ok := tasks.RepoTaskQueue.GetSnapshot(id)
 
 		if !ok {
 			c.Error(NewTaskStatusError(nil, http.StatusNotFound, "Task not found"))
@@ -127,62 +196,96 @@ func HandleTask(s *Server) func(c *gin.Context) {
 
 		switch action {
 		case ACTION_STATUS:
-			if task.Err != nil {
-				c.Error(NewTaskStatusError(nil, http.StatusBadRequest, task.Err.Error()))
+			var info tasks.QueueInfo
+
+			if task, live := tasks.RepoTaskQueue.GetTask(id); live {
+				tasks.RepoTaskQueue.Poll(task)
+				info = tasks.RepoTaskQueue.Info(task)
+			}
+
+			if snapshot.Err != nil {
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, snapshot.Err.Error()))
 				return
 			}
 
 			c.JSON(http.StatusOK, TaskInfo{
-				Status:       task.Status,
-				Done:         task.Status == tasks.STATUS_DONE,
-				Error:        false,
-				ErrorMessage: "",
-				Result:       nil,
+				Status:        snapshot.State,
+				Done:          snapshot.Finished(),
+				Error:         false,
+				ErrorMessage:  "",
+				Position:      info.Position,
+				Ahead:         info.Ahead,
+				EstimatedWait: info.Wait.Seconds(),
+				Result:        nil,
 			})
 		case ACTION_RESULT:
-			if task.Status != tasks.STATUS_DONE {
-				c.Error(NewTaskStatusError(task, http.StatusBadRequest, "Task not done"))
+			if !snapshot.Finished() {
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, "Task not done"))
 				return
 			}
 
-			tasks.RepoTaskQueue.DeleteTask(id)
-
-			if task.Err != nil {
-				c.Error(NewTaskStatusError(task, http.StatusBadRequest, task.Err.Error()))
+			// the result is kept until the task expires, it is read again to export markers
+			if snapshot.Err != nil {
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, snapshot.Err.Error()))
 				return
 			}
 
+			result := snapshot.Result
 			data := &ResponseData{
 				RepoSizeLimit: config.Vars.MaxRepoSize,
 				ParallelMode:  config.Vars.UseFileWorkers,
-				Languages:     task.Result.Languages,
-				TotalLines:    task.Result.TotalLines,
-				TotalFiles:    task.Result.TotalFiles,
-				TotalBlank:    task.Result.TotalBlank,
-				TotalComments: task.Result.TotalComments,
-				FetchSpeed:    task.FetchSpeed,
-				AnalysisSpeed: task.AnalysisSpeed,
+				Languages:     result.Languages,
+				Dependencies:  result.Dependencies,
+				Roles:         result.Roles,
+				TestRatio:     result.TestRatio,
+				TotalLines:    result.TotalLines,
+				TotalFiles:    result.TotalFiles,
+				TotalBlank:    result.TotalBlank,
+				TotalComments: result.TotalComments,
+				Duplication:   result.Duplication,
+				Markers:       result.Markers,
+				License:       result.License,
+				FetchSpeed:    snapshot.FetchSpeed,
+				AnalysisSpeed: snapshot.AnalysisSpeed,
+				Ref:           snapshot.Ref.Name,
+				Commit:        snapshot.Ref.Commit,
 			}
 
-			keyForRedis, ok := RepoTaskResultKey(task.Owner, task.Name)
+			keyForRedis, ok := RepoTaskResultKey(snapshot.GetURL(), snapshot.Ref, snapshot.Opts)
 
-			if ok {
+			// results with custom languages are specific to the request,
+			// private ones must not be seen by anyone without access to the repository
+			if ok && len(snapshot.Languages) == 0 && !snapshot.Private && s.Redis != nil {
 				s.Redis.SetCache(keyForRedis, data)
 			}
 
+			// cached results are shared, the task is of this request only
+			data.TaskID = id
+
 			switch c.GetHeader("Accept") {
 			case "application/json":
 
-				for _, lang := range data.Languages {
-					lang.BadgeUrl = BadgeURL(lang.Name)
+				langRegistry := snapshot.Opts.Registry
+
+				if langRegistry == nil {
+					langRegistry = analyzer.DefaultRegistry()
+				}
+
+				// the result is shared by identical requests, languages are copied to add badges
+				data.Languages = make([]*analyzer.Language, 0, len(result.Languages))
+
+				for _, resultLang := range result.Languages {
+					lang := *resultLang
+					lang.BadgeUrl = badgeURL(langRegistry, lang.Name)
+					data.Languages = append(data.Languages, &lang)
 				}
 
 				data.FetchSpeedStr = FormatTime(data.FetchSpeed)
 				data.AnalysisSpeeStr = FormatTime(data.AnalysisSpeed)
 
 				c.JSON(http.StatusOK, TaskInfo{
-					Status:       task.Status,
-					Done:         task.Status == tasks.STATUS_DONE,
+					Status:       snapshot.State,
+					Done:         snapshot.Finished(),
 					Error:        false,
 					ErrorMessage: "",
 					Result:       data,
@@ -191,13 +294,141 @@ func HandleTask(s *Server) func(c *gin.Context) {
 			case "text/html":
 				c.HTML(http.StatusOK, "table.html", data)
 				return
+			case "text/csv":
+				writeMarkersCSV(c, &snapshot)
+				return
 			default:
-				c.Error(NewTaskStatusError(task, http.StatusBadRequest, "Bad Accept Header"))
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, "Bad Accept Header"))
+			}
+		case ACTION_EXPORT:
+			if !snapshot.Finished() {
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, "Task not done"))
+				return
 			}
 
+			if snapshot.Err != nil {
+				c.Error(NewTaskStatusError(&snapshot, http.StatusBadRequest, snapshot.Err.Error()))
+				return
+			}
+
+			writeMarkersCSV(c, &snapshot)
+
 		default:
-			c.Error(NewTaskStatusError(task, http.StatusNotFound, "Unknown action"))
+			c.Error(NewTaskStatusError(&snapshot, http.StatusNotFound, "Unknown action"))
+		}
+
+	}
+}
+
+// respond with the markers of the succeeded task as a CSV attachment
+func writeMarkersCSV(c *gin.Context, snapshot *tasks.TaskSnapshot) {
+	markers := snapshot.Result.Markers
+
+	if markers == nil {
+		c.Error(NewTaskStatusError(snapshot, http.StatusBadRequest, "Marker scan was not requested"))
+		return
+	}
+
+	// GitLab owners are group paths
+	filename := fmt.Sprintf("%s-%s-markers.csv", strings.ReplaceAll(snapshot.Owner, "/", "-"), snapshot.Name)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	markers.WriteCSV(c.Writer)
+}
+
+// DELETE /api/task/:id
+//
+// queued task is removed from the queue, running one is aborted,
+// both are kept as canceled, finished task is deleted with its result
+func HandleCancelTask(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		snapshot, ok := tasks.RepoTaskQueue.GetSnapshot(id)
+
+		if !ok {
+			c.Error(NewTaskStatusError(nil, http.StatusNotFound, "Task not found"))
+			return
+		}
+
+		task, live := tasks.RepoTaskQueue.GetTask(id)
+		canceled := tasks.RepoTaskQueue.Cancel(id)
+
+		// a running task is aborted by its worker, so it may be not canceled yet
+		if live {
+			snapshot = task.Snapshot()
+		}
+
+		// the result of the finished task is kept until it expires
+		if !canceled {
+			c.Error(NewTaskStatusError(&snapshot, http.StatusConflict, "Task is already finished"))
+			return
+		}
+
+		c.JSON(http.StatusOK, TaskInfo{
+			Status:       snapshot.State,
+			Done:         snapshot.Finished(),
+			Error:        false,
+			ErrorMessage: "",
+			Result:       nil,
+		})
+	}
+}
+
+type QueueList struct {
+	Workers int                `json:"workers"`
+	Running int                `json:"running"`
+	Queued  int                `json:"queued"`
+	Tasks   []tasks.QueueEntry `json:"tasks"`
+}
+
+// GET /api/admin/queue
+func HandleGetQueue(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		entries := tasks.RepoTaskQueue.Entries()
+		list := QueueList{
+			Workers: config.Vars.TaskWorkers,
+			Tasks:   entries,
+		}
+
+		for _, entry := range entries {
+			if entry.Position == 0 {
+				list.Running++
+			} else {
+				list.Queued++
+			}
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GET /api/admin/metrics
+//
+// rate limits of the server GitHub credentials in the Prometheus text format
+func HandleGetMetrics(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		rates := providers.RateLimits()
+		metrics := []struct {
+			name  string
+			help  string
+			value func(rate providers.RateLimit) int64
+		}{
+			{"github_rate_limit", "Requests allowed in the rate limit window", func(rate providers.RateLimit) int64 { return int64(rate.Limit) }},
+			{"github_rate_limit_remaining", "Requests left in the rate limit window", func(rate providers.RateLimit) int64 { return int64(rate.Remaining) }},
+			{"github_rate_limit_reset_seconds", "Unix time the rate limit window resets at", func(rate providers.RateLimit) int64 { return rate.Reset.Unix() }},
+		}
+
+		var body strings.Builder
+
+		for _, metric := range metrics {
+			fmt.Fprintf(&body, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+
+			for _, rate := range rates {
+				fmt.Fprintf(&body, "%s{credential=%q} %d\n", metric.name, rate.Credential, metric.value(rate))
+			}
 		}
 
+		c.String(http.StatusOK, body.String())
 	}
 }
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"git-analyzer/pkg/analyzer"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LanguageInfo struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	Color         string     `json:"color"`
+	Group         string     `json:"group"`
+	Aliases       []string   `json:"aliases"`
+	Extensions    []string   `json:"extensions"`
+	Filenames     []string   `json:"filenames"`
+	Interpreters  []string   `json:"interpreters"`
+	LineComments  []string   `json:"line_comments"`
+	BlockComments [][]string `json:"block_comments"`
+	BadgeUrl      string     `json:"badge_url"`
+}
+
+type LanguageList struct {
+	Total     int             `json:"total"`
+	Languages []*LanguageInfo `json:"languages"`
+}
+
+type LanguageDetection struct {
+	Filename string        `json:"filename"`
+	Language string        `json:"language"` // "Other" if not recognized
+	Info     *LanguageInfo `json:"info"`     // nil if not recognized
+}
+
+type LanguageCatalog struct {
+	Query     string
+	Type      string
+	Types     []string
+	Total     int
+	Languages []*LanguageInfo
+}
+
+func newLanguageInfo(data *analyzer.LanguageData) *LanguageInfo {
+	return &LanguageInfo{
+		Name:          data.Name,
+		Type:          data.Type,
+		Color:         data.Color,
+		Group:         data.Group,
+		Aliases:       nonNil(data.Aliases),
+		Extensions:    nonNil(data.Extensions),
+		Filenames:     nonNil(data.Filenames),
+		Interpreters:  nonNil(data.Interpreters),
+		LineComments:  nonNil(data.LineComments),
+		BlockComments: nonNil(data.BlockComments),
+		BadgeUrl:      badgeURL(analyzer.DefaultRegistry(), data.Name),
+	}
+}
+
+// empty lists are rendered as [] instead of null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+
+	return list
+}
+
+// matches query against name, aliases, extensions and filenames ignoring case
+func matchLanguage(data *analyzer.LanguageData, query, langType string) bool {
+	if langType != "" && data.Type != langType {
+		return false
+	}
+
+	if query == "" {
+		return true
+	}
+
+	if strings.Contains(strings.ToLower(data.Name), query) {
+		return true
+	}
+
+	ext := strings.TrimPrefix(query, ".")
+	match := func(value string) bool {
+		return strings.ToLower(value) == query || strings.ToLower(value) == ext
+	}
+
+	return slices.ContainsFunc(data.Aliases, match) ||
+		slices.ContainsFunc(data.Extensions, match) ||
+		slices.ContainsFunc(data.Filenames, match)
+}
+
+func findLanguages(query, langType string) []*LanguageInfo {
+	query = strings.ToLower(strings.TrimSpace(query))
+	langs := make([]*LanguageInfo, 0)
+
+	for _, data := range analyzer.DefaultRegistry().Languages() {
+		if matchLanguage(data, query, langType) {
+			langs = append(langs, newLanguageInfo(data))
+		}
+	}
+
+	return langs
+}
+
+// GET /api/languages?q=&type=
+func HandleGetLanguages(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		langType := c.Query("type")
+
+		if langType != "" && !slices.Contains(analyzer.LanguageTypes, langType) {
+			c.Error(NewAnalyzeError(http.StatusBadRequest, fmt.Sprintf("Unknown language type %q", langType)))
+			return
+		}
+
+		langs := findLanguages(c.Query("q"), langType)
+
+		c.JSON(http.StatusOK, LanguageList{
+			Total:     len(langs),
+			Languages: langs,
+		})
+	}
+}
+
+// GET /api/languages/:name, name can be an alias
+func HandleGetLanguage(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		data, ok := analyzer.DefaultRegistry().FindLanguage(c.Param("name"))
+
+		if !ok {
+			c.Error(NewAnalyzeError(http.StatusNotFound, "Language not found"))
+			return
+		}
+
+		c.JSON(http.StatusOK, newLanguageInfo(data))
+	}
+}
+
+// GET|POST /api/languages/detect?filename=&content=
+//
+// content is the beginning of the file, it is used for
+// shebang and modeline detection of files without known extension
+func HandleDetectLanguage(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		filename := getParam(c, "filename")
+
+		if filename == "" {
+			c.Error(NewAnalyzeError(http.StatusBadRequest, "Filename is required"))
+			return
+		}
+
+		content := getParam(c, "content")
+
+		if len(content) > analyzer.MODELINE_MAX_BYTES {
+			content = content[:analyzer.MODELINE_MAX_BYTES]
+		}
+
+		registry := analyzer.DefaultRegistry()
+		detection := LanguageDetection{
+			Filename: filename,
+			Language: registry.Detect(filename, []byte(content)),
+		}
+
+		if data, ok := registry.GetLanguage(detection.Language); ok {
+			detection.Info = newLanguageInfo(data)
+		}
+
+		c.JSON(http.StatusOK, detection)
+	}
+}
+
+// GET /languages
+func HandleLanguageCatalog(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		query := c.Query("q")
+		langType := c.Query("type")
+
+		if !slices.Contains(analyzer.LanguageTypes, langType) {
+			langType = ""
+		}
+
+		langs := findLanguages(query, langType)
+
+		c.HTML(http.StatusOK, "languages.html", LanguageCatalog{
+			Query:     query,
+			Type:      langType,
+			Types:     analyzer.LanguageTypes,
+			Total:     len(langs),
+			Languages: langs,
+		})
+	}
+}
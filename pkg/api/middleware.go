@@ -1,8 +1,14 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
+	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/providers"
+	"git-analyzer/pkg/tasks"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,7 +18,7 @@ func ValidateFormMV(s *Server) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		repoURL := c.PostForm("repo_url")
 
-		owner, name, err := extractMeta(repoURL)
+		provider, owner, name, err := providers.Parse(repoURL)
 
 		if err != nil {
 			owner = c.PostForm("repo_owner")
@@ -23,26 +29,66 @@ func ValidateFormMV(s *Server) func(c *gin.Context) {
 				c.Abort()
 				return
 			}
+
+			// the owner and name fields are of github.com
+			provider = providers.GitHub
 		}
 
-		if !RepoIsExists(owner, name) {
-			c.Error(NewAnalyzeError(http.StatusBadRequest, "Repository does not exist"))
-			c.Abort()
+		ctx, cancel := tasks.WithPhaseTimeout(c.Request.Context(), tasks.PHASE_METADATA,
+			time.Duration(config.Vars.MetadataTimeout)*time.Second)
+		defer cancel()
+
+		// private repositories are checked and cloned with the token of the user
+		token := getAccessToken(c)
+		repo, err := provider.Repo(ctx, owner, name, token)
+
+		if err != nil {
+			abortMetadataLookup(c, ctx, tasks.ScrubSecret(err, token))
+			return
+		}
+
+		ref, err := provider.ResolveRef(ctx, repo, strings.TrimSpace(c.PostForm("ref")), token)
+
+		if err != nil {
+			abortMetadataLookup(c, ctx, tasks.ScrubSecret(err, token))
 			return
 		}
 
+		c.Set("repo", repo)
 		c.Set("repo_owner", owner)
 		c.Set("repo_name", name)
+		c.Set("repo_ref", ref)
 		c.Next()
 	}
 }
 
+// the host is slow rather than the request invalid if the lookup timed out
+func abortMetadataLookup(c *gin.Context, ctx context.Context, err error) {
+	if errTimeout := tasks.PhaseTimeoutOf(ctx); errTimeout != nil {
+		c.Error(NewAnalyzeError(http.StatusGatewayTimeout, errTimeout.Error()))
+	} else {
+		c.Error(NewAnalyzeError(http.StatusBadRequest, err.Error()))
+	}
+
+	c.Abort()
+}
+
 func RedisRepoTaskCacheMV(s *Server) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		owner := getOwner(c)
-		name := getName(c)
+		if s.Redis == nil {
+			c.Next()
+			return
+		}
+
+		repo := getRepo(c)
+
+		// results with custom languages are not cached
+		if repo == nil || strings.TrimSpace(c.PostForm("languages")) != "" {
+			c.Next()
+			return
+		}
 
-		key, ok := RepoTaskResultKey(owner, name)
+		key, ok := RepoTaskResultKey(repo.CloneURL, getRef(c), getOptions(c))
 
 		if !ok {
 			c.Next()
@@ -68,6 +114,11 @@ func RedisRepoTaskCacheMV(s *Server) func(c *gin.Context) {
 
 func RedisRateLimitMV(s *Server) func(*gin.Context) {
 	return func(c *gin.Context) {
+		if s.Redis == nil {
+			c.Next()
+			return
+		}
+
 		key := fmt.Sprintf("ip:%s", c.ClientIP())
 
 		res := s.Redis.RateLimitAllow(key)
@@ -113,3 +164,26 @@ func CSP() func(*gin.Context) {
 		c.Header("Content-Security-Policy", cspValue)
 	}
 }
+
+// allows requests with the admin token only, admin routes do not exist without it
+func AdminMV(s *Server) func(*gin.Context) {
+	return func(c *gin.Context) {
+		token := getBearerToken(c)
+		adminToken := config.Vars.AdminToken
+
+		if adminToken == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":         true,
+				"error_message": "Invalid admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
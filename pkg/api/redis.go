@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"git-analyzer/pkg/analyzer"
 	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/tasks"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/go-redis/cache/v9"
@@ -89,13 +93,109 @@ func (r *RedisDB) SetCache(key string, value interface{}) {
 	}
 }
 
-func RepoTaskResultKey(repoOwner, repoName string) (string, bool) {
-	if repoOwner == "" || repoName == "" {
+// results are cached per commit and options, so a moved branch is analyzed again
+// and a result is never given for other options
+func RepoTaskResultKey(repoURL string, ref tasks.Ref, opts *analyzer.Options) (string, bool) {
+	if repoURL == "" || ref.Commit == "" {
 		return "", false
 	}
 
-	str := fmt.Sprintf("%s:%s", repoOwner, repoName)
+	data, err := json.Marshal(opts)
+
+	if err != nil {
+		return "", false
+	}
+
+	str := fmt.Sprintf("%s:%s:%s:%s", strings.ToLower(repoURL), ref.Name, ref.Commit, data)
 	hash := md5.Sum([]byte(str))
 
 	return hex.EncodeToString(hash[:]), true
 }
+
+const REDIS_TASKS_KEY = "tasks" // set of persisted task ids
+
+func redisTaskKey(id string) string {
+	return "task:" + id
+}
+
+// RedisTaskStore keeps tasks as JSON strings with TTL
+// and their ids in a set to list them on boot
+type RedisTaskStore struct {
+	db *RedisDB
+}
+
+func NewRedisTaskStore(db *RedisDB) *RedisTaskStore {
+	return &RedisTaskStore{db: db}
+}
+
+func (r *RedisTaskStore) Save(task *tasks.RepoTask) error {
+	data, err := tasks.EncodeTask(task)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.client.TxPipelined(r.db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(r.db.ctx, redisTaskKey(task.ID), data, tasks.TASK_TTL)
+		pipe.SAdd(r.db.ctx, REDIS_TASKS_KEY, task.ID)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisTaskStore) Get(id string) (*tasks.RepoTask, bool) {
+	data, err := r.db.client.Get(r.db.ctx, redisTaskKey(id)).Bytes()
+
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error fetching task from Redis: %v", err)
+		}
+		return nil, false
+	}
+
+	task, err := tasks.DecodeTask(data)
+
+	if err != nil {
+		log.Printf("Broken task %s in Redis: %v", id, err)
+		return nil, false
+	}
+
+	return task, true
+}
+
+func (r *RedisTaskStore) Delete(id string) error {
+	_, err := r.db.client.TxPipelined(r.db.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(r.db.ctx, redisTaskKey(id))
+		pipe.SRem(r.db.ctx, REDIS_TASKS_KEY, id)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisTaskStore) List() ([]*tasks.RepoTask, error) {
+	ids, err := r.db.client.SMembers(r.db.ctx, REDIS_TASKS_KEY).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*tasks.RepoTask, 0, len(ids))
+
+	for _, id := range ids {
+		task, ok := r.Get(id)
+
+		// expired tasks are removed from the set lazily
+		if !ok {
+			r.db.client.SRem(r.db.ctx, REDIS_TASKS_KEY, id)
+			continue
+		}
+
+		list = append(list, task)
+	}
+
+	tasks.SortTasks(list)
+
+	return list, nil
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/providers"
+	"git-analyzer/pkg/tasks"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/gin-contrib/cors"
@@ -18,19 +21,33 @@ type Server struct {
 }
 
 func New() *Server {
-	return &Server{
-		Redis: CreateRedisDB(),
+	s := &Server{}
+
+	var store tasks.TaskStore
+
+	// tasks are kept in Redis when it is configured, on disk otherwise
+	if config.Vars.RedisHost != "" {
+		s.Redis = CreateRedisDB()
+		store = NewRedisTaskStore(s.Redis)
+	} else {
+		diskStore, err := tasks.NewDiskTaskStore(config.Vars.TaskStoreDir)
+
+		if err != nil {
+			log.Fatalf("Failed to open task store: %v", err)
+		}
+
+		store = diskStore
 	}
+
+	if err := tasks.RepoTaskQueue.UseStore(store); err != nil {
+		log.Fatalf("Failed to restore tasks: %v", err)
+	}
+
+	return s
 }
 
 func (s *Server) CheckCredentials() error {
-	ctx := context.Background()
-	_, resp, err := githubClient.Users.Get(ctx, "")
-	if err != nil && resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("Invalid token!")
-		// panic("Invalid token!")
-	}
-	return nil
+	return providers.GitHub.CheckCredentials(context.Background())
 }
 
 func (s *Server) IsProduction() bool {
@@ -44,7 +61,7 @@ func (s *Server) ConfigureMiddleware(r *gin.Engine) {
 		r.Use(CSP())
 		r.Use(cors.New(cors.Config{
 			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"POST", "GET"},
+			AllowMethods:     []string{"POST", "GET", "DELETE"},
 			AllowCredentials: true,
 		}))
 	}
@@ -53,6 +70,7 @@ func (s *Server) ConfigureMiddleware(r *gin.Engine) {
 
 func (s *Server) ConfigureHandlers(r *gin.Engine) {
 	r.GET("/", HandleGetForm(s))
+	r.GET("/languages", HandleLanguageCatalog(s))
 	apiGroup := r.Group("/api")
 
 	{
@@ -67,6 +85,15 @@ func (s *Server) ConfigureHandlers(r *gin.Engine) {
 
 		apiGroup.POST("/task", createTaskHandlers...)
 		apiGroup.GET("/task/:id/:action", HandleTask(s))
+		apiGroup.DELETE("/task/:id", HandleCancelTask(s))
+
+		apiGroup.GET("/admin/queue", AdminMV(s), HandleGetQueue(s))
+		apiGroup.GET("/admin/metrics", AdminMV(s), HandleGetMetrics(s))
+
+		apiGroup.GET("/languages", HandleGetLanguages(s))
+		apiGroup.GET("/languages/detect", HandleDetectLanguage(s))
+		apiGroup.POST("/languages/detect", HandleDetectLanguage(s))
+		apiGroup.GET("/languages/:name", HandleGetLanguage(s))
 	}
 }
 
@@ -88,8 +115,9 @@ func (s *Server) ConfigureStatic(r *gin.Engine) {
 }
 
 func (s *Server) Start() {
+	// the server works without valid credentials, only with lower rate limits
 	if err := s.CheckCredentials(); err != nil {
-		panic(err.Error())
+		log.Printf("Failed to check GitHub credentials: %v", err)
 	}
 
 	isProd := s.IsProduction()
@@ -99,10 +127,14 @@ func (s *Server) Start() {
 	}
 
 	r := gin.Default()
+	// language names like Tcl/Tk are escaped in paths
+	r.UseRawPath = true
 
 	r.SetFuncMap(template.FuncMap{
 		"FormatTime": FormatTime,
 		"BadgeURL":   BadgeURL,
+		"Percent":    Percent,
+		"Join":       strings.Join,
 	})
 
 	s.ConfigureMiddleware(r)
@@ -1,73 +1,131 @@
 package api
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
-	"net/url"
+	"git-analyzer/pkg/analyzer"
+	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/providers"
+	"git-analyzer/pkg/tasks"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func validateRepoURL(rawurl string) bool {
-	parsedURL, err := url.Parse(rawurl)
+const LANGUAGES_MAX_SIZE = 16 * 1024 // max size of custom language definitions of a request
 
-	if err != nil {
-		return false
-	}
+func getRef(ctx *gin.Context) tasks.Ref {
+	value, ok := ctx.Get("repo_ref")
 
-	if parsedURL.Host != "github.com" {
-		return false
+	if !ok {
+		return tasks.Ref{}
 	}
 
-	matches := githubRegexp.FindStringSubmatch(parsedURL.Path)
+	return value.(tasks.Ref)
+}
 
-	if matches == nil || len(matches) < 3 {
-		return false
-	}
+func getPostFormBool(ctx *gin.Context, key string) bool {
+	value := ctx.PostForm(key)
 
-	return true
+	return value == "1" || value == "true" || value == "on"
 }
 
-func extractMeta(rawurl string) (onwer string, repo string, err error) {
-	parsedURL, err := url.Parse(rawurl)
+// analysis options of the request, the language registry is set by the caller
+func getOptions(ctx *gin.Context) *analyzer.Options {
+	return &analyzer.Options{
+		ExcludeFilePatterns: ctx.PostFormArray("exclude_file_patterns[]"),
+		ExcludeDirPatterns:  ctx.PostFormArray("exclude_dir_patterns[]"),
+		DetectDuplicates:    getPostFormBool(ctx, "detect_duplicates"),
+		ScanMarkers:         getPostFormBool(ctx, "scan_markers"),
+		MarkerTags:          ctx.PostFormArray("marker_tags[]"),
+		GroupLanguages:      getPostFormBool(ctx, "group_languages"),
+		LanguageTypes:       ctx.PostFormArray("language_types[]"),
+	}
+}
 
-	if err != nil {
-		return "", "", fmt.Errorf("invalid url: %s", err)
+// custom language definitions of the request and the default registry extended with them,
+// accepts a single definition object or a list of them, returns nil if none were sent
+func getLanguageRegistry(ctx *gin.Context) ([]analyzer.LanguageData, *analyzer.LanguageRegistry, error) {
+	raw := strings.TrimSpace(ctx.PostForm("languages"))
+
+	if raw == "" {
+		return nil, nil, nil
 	}
 
-	if parsedURL.Host != "github.com" {
-		if parsedURL.Host == "" {
-			parsedURL.Host = "none"
-		}
-		return "", "", fmt.Errorf("Wrong host, expected github.com, got %s", parsedURL.Host)
+	if len(raw) > LANGUAGES_MAX_SIZE {
+		return nil, nil, fmt.Errorf("Custom languages must not exceed %d KB", LANGUAGES_MAX_SIZE/1024)
+	}
+
+	if strings.HasPrefix(raw, "{") {
+		raw = "[" + raw + "]"
 	}
 
-	matches := githubRegexp.FindStringSubmatch(parsedURL.Path)
+	overlay, err := analyzer.ParseLanguages([]byte(raw))
 
-	if matches == nil || len(matches) < 3 {
-		return "", "", fmt.Errorf("Url must contain owner and repo: %s", rawurl)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	owner, repoName := matches[1], matches[2]
+	registry, err := analyzer.DefaultRegistry().Extend(overlay)
+
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return owner, repoName, nil
+	return overlay, registry, nil
 }
 
-func getOwner(ctx *gin.Context) string {
-	value, ok := ctx.Get("repo_owner")
+// access token the user sent to analyze a private repository, empty if there is none
+func getAccessToken(ctx *gin.Context) string {
+	return strings.TrimSpace(ctx.PostForm("access_token"))
+}
+
+// repository resolved by ValidateFormMV, nil if there is none
+func getRepo(ctx *gin.Context) *providers.Repo {
+	value, ok := ctx.Get("repo")
 
 	if !ok {
-		return ""
+		return nil
 	}
 
-	return value.(string)
+	return value.(*providers.Repo)
 }
 
-func getName(ctx *gin.Context) string {
-	value, ok := ctx.Get("repo_name")
+// bearer token of the Authorization header, empty if there is none
+func getBearerToken(ctx *gin.Context) string {
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
 
 	if !ok {
 		return ""
 	}
 
-	return value.(string)
+	return strings.TrimSpace(token)
+}
+
+// client of the request for fair scheduling, API clients are identified
+// by their key name, others by the IP address. An unknown key is an error
+func getClient(ctx *gin.Context) (client string, authenticated bool, err error) {
+	token := getBearerToken(ctx)
+
+	if token == "" {
+		return "ip:" + ctx.ClientIP(), false, nil
+	}
+
+	for apiKey, name := range config.Vars.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1 {
+			return "api:" + name, true, nil
+		}
+	}
+
+	return "", false, errors.New("Invalid API key")
+}
+
+// returns query parameter, or post form value if it is not in the query
+func getParam(ctx *gin.Context, key string) string {
+	if value, ok := ctx.GetQuery(key); ok {
+		return value
+	}
+
+	return ctx.PostForm(key)
 }
@@ -4,22 +4,40 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
 type Config struct {
-	DiskSize       int64
-	MaxRepoSize    int64
-	SyncEvery      int32
-	UseFileWorkers bool
-	Debug          bool
-	GoEnv          string
-	MainPort       string
-	RedisHost      string
-	RedisPort      string
-	GithubApiPat   string
+	DiskSize             int64
+	MaxRepoSize          int64
+	SyncEvery            int32
+	UseFileWorkers       bool
+	Debug                bool
+	GoEnv                string
+	MainPort             string
+	RedisHost            string
+	RedisPort            string
+	GithubApiPat         string
+	LanguagesPath        string            // optional language definitions replacing the embedded ple.json
+	LanguagesOverlayPath string            // optional language definitions layered on top of the base ones
+	TaskStoreDir         string            // directory of the task store used when Redis is not configured
+	TaskWorkers          int               // number of tasks processed at the same time
+	TaskPollTimeout      int               // seconds without status polls after which a task is canceled, 0 disables it
+	MetadataTimeout      int               // seconds to resolve the repository and the ref with the host API, 0 disables it
+	FetchTimeout         int               // seconds to clone a repository, retries included, 0 disables it
+	AnalysisTimeout      int               // seconds to analyze a cloned repository, 0 disables it
+	ApiKeys              map[string]string // API client names by their keys, their tasks are served first
+	AdminToken           string            // token of the admin endpoints, they are disabled if empty
+	GitlabURLs           []string          // base URLs of self-hosted GitLab instances, gitlab.com is always known
+	GiteaURLs            []string          // base URLs of Gitea and Forgejo instances, codeberg.org is always known
+	GithubURLs           []string          // web base URLs of GitHub repositories, github.com by default
+	GithubApiURL         string            // API base URL of GitHub Enterprise Server, api.github.com if empty
+	GithubUploadURL      string            // upload URL of GitHub Enterprise Server, GithubApiURL if empty
+	GithubAppID          int64             // GitHub App the API is called as, 0 if there is none
+	GithubAppKeyPath     string            // PEM private key of the GitHub App
 }
 
 var Vars *Config
@@ -54,6 +72,19 @@ func getEnv(key string) string {
 	return env
 }
 
+// returns empty string if the variable is not set
+func getEnvOptional(key string) string {
+	return os.Getenv(key)
+}
+
+func getEnvDefault(key, defaultValue string) string {
+	if env, ok := os.LookupEnv(key); ok && env != "" {
+		return env
+	}
+
+	return defaultValue
+}
+
 func getEnvInt(key string) int {
 	env := getEnv(key)
 	val, err := strconv.Atoi(env)
@@ -68,6 +99,58 @@ func getEnvInt(key string) int {
 	return val
 }
 
+func getEnvIntDefault(key string, defaultValue int) int {
+	env := getEnvOptional(key)
+
+	if env == "" {
+		return defaultValue
+	}
+
+	val, err := strconv.Atoi(env)
+
+	if err != nil {
+		panic(fmt.Errorf("Invalid env var %s", key))
+	}
+
+	return val
+}
+
+// parses comma separated name:key pairs
+func getEnvApiKeys(key string) map[string]string {
+	keys := make(map[string]string)
+
+	for _, pair := range strings.Split(getEnvOptional(key), ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		name, apiKey, ok := strings.Cut(pair, ":")
+
+		if !ok || name == "" || apiKey == "" {
+			panic(fmt.Errorf("Invalid env var %s, expected name:key pairs", key))
+		}
+
+		keys[apiKey] = name
+	}
+
+	return keys
+}
+
+// parses comma separated values
+func getEnvList(key string) []string {
+	list := make([]string, 0)
+
+	for _, value := range strings.Split(getEnvOptional(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+
+	return list
+}
+
 func getEnvBool(key string) bool {
 	env := getEnv(key)
 
@@ -82,16 +165,33 @@ var onceInitConfig = &sync.Once{}
 
 func InitConfig() {
 	Vars = &Config{
-		DiskSize:       int64(getEnvInt("MAX_DISK_SIZE")),
-		MaxRepoSize:    int64(getEnvInt("MAX_REPO_SIZE")),
-		SyncEvery:      int32(getEnvInt("SYNC_EVERY")),
-		UseFileWorkers: getEnvBool("USE_FILE_WORKERS"),
-		Debug:          getEnvBool("DEBUG"),
-		MainPort:       getEnv("MAIN_PORT"),
-		RedisPort:      getEnv("REDIS_PORT"),
-		RedisHost:      getEnv("REDIS_HOST"),
-		GoEnv:          getEnv("GO_ENV"),
-		GithubApiPat:   getEnv("API_PAT"),
+		DiskSize:             int64(getEnvInt("MAX_DISK_SIZE")),
+		MaxRepoSize:          int64(getEnvInt("MAX_REPO_SIZE")),
+		SyncEvery:            int32(getEnvInt("SYNC_EVERY")),
+		UseFileWorkers:       getEnvBool("USE_FILE_WORKERS"),
+		Debug:                getEnvBool("DEBUG"),
+		MainPort:             getEnv("MAIN_PORT"),
+		RedisPort:            getEnvOptional("REDIS_PORT"),
+		RedisHost:            getEnvOptional("REDIS_HOST"),
+		GoEnv:                getEnv("GO_ENV"),
+		GithubApiPat:         getEnvOptional("API_PAT"),
+		LanguagesPath:        getEnvOptional("LANGUAGES_PATH"),
+		LanguagesOverlayPath: getEnvOptional("LANGUAGES_OVERLAY_PATH"),
+		TaskStoreDir:         getEnvDefault("TASK_STORE_DIR", "data/tasks"),
+		TaskWorkers:          getEnvIntDefault("TASK_WORKERS", 1),
+		TaskPollTimeout:      getEnvIntDefault("TASK_POLL_TIMEOUT", 60),
+		MetadataTimeout:      getEnvIntDefault("METADATA_TIMEOUT", 30),
+		FetchTimeout:         getEnvIntDefault("FETCH_TIMEOUT", 600),
+		AnalysisTimeout:      getEnvIntDefault("ANALYSIS_TIMEOUT", 600),
+		ApiKeys:              getEnvApiKeys("API_KEYS"),
+		AdminToken:           getEnvOptional("ADMIN_TOKEN"),
+		GitlabURLs:           getEnvList("GITLAB_URLS"),
+		GiteaURLs:            getEnvList("GITEA_URLS"),
+		GithubURLs:           getEnvList("GITHUB_URLS"),
+		GithubApiURL:         getEnvOptional("GITHUB_API_URL"),
+		GithubUploadURL:      getEnvOptional("GITHUB_UPLOAD_URL"),
+		GithubAppID:          int64(getEnvIntDefault("GITHUB_APP_ID", 0)),
+		GithubAppKeyPath:     getEnvOptional("GITHUB_APP_KEY_PATH"),
 	}
 }
 
@@ -0,0 +1,129 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const MAX_REDIRECTS = 10 // redirects followed by git HTTP requests
+
+var ErrPrivateAddress = errors.New("Host is not allowed, it is not a public address")
+
+// special purpose ranges that look like global unicast but are not reachable on the internet
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",       // this network
+	"100.64.0.0/10",   // shared address space of carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, the broadcast address included
+	"64:ff9b::/96",    // IPv4/IPv6 translation, it may embed a private IPv4 address
+	"64:ff9b:1::/48",  // local IPv4/IPv6 translation
+	"100::/64",        // discard only
+	"2001::/23",       // IETF protocol assignments
+	"2001:db8::/32",   // documentation
+	"fec0::/10",       // site-local, deprecated
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+type publicOnlyKey struct{}
+
+// PublicOnly makes HTTP requests with the context reach only public addresses.
+// The address is checked when the connection is made, so neither redirects
+// nor hosts resolving to another address later get to the network of the server
+func PublicOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, publicOnlyKey{}, true)
+}
+
+// IsPublicOnly tells whether requests with the context must reach only public addresses
+func IsPublicOnly(ctx context.Context) bool {
+	publicOnly, _ := ctx.Value(publicOnlyKey{}).(bool)
+	return publicOnly
+}
+
+// IsPublicIP tells whether the address is reachable from the internet,
+// multicast, private, unique local and special purpose addresses are not
+func IsPublicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rejects connections to the resolved address if it is not public
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+// NewTransport returns the transport of public only requests, it has its own connections
+// so that the ones to private hosts of trusted requests are never reused
+func NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkPublicAddress}
+
+	// a proxy would hide the address of the host
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+// CheckRedirect keeps redirects of public only requests on HTTPS, the address is checked by the dialer
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= MAX_REDIRECTS {
+		return fmt.Errorf("Stopped after %d redirects", MAX_REDIRECTS)
+	}
+
+	if !IsPublicOnly(req.Context()) {
+		return nil
+	}
+
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: redirect to %s", ErrPrivateAddress, req.URL.Redacted())
+	}
+
+	if ip := net.ParseIP(req.URL.Hostname()); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("%w: redirect to %s", ErrPrivateAddress, req.URL.Hostname())
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package netguard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"239.255.255.250", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fec0::1", false},
+		{"ff02::1", false},
+		{"64:ff9b::a00:1", false},
+		{"2001:db8::1", false},
+	}
+
+	for _, test := range tests {
+		if public := IsPublicIP(net.ParseIP(test.ip)); public != test.public {
+			t.Errorf("IsPublicIP(%s): expected %v, got %v", test.ip, test.public, public)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		url        string
+		publicOnly bool
+		ok         bool
+	}{
+		{"https://example.com/owner/name.git", true, true},
+		{"http://example.com/owner/name.git", true, false},
+		{"https://127.0.0.1/owner/name.git", true, false},
+		{"https://169.254.169.254/latest/meta-data", true, false},
+		{"https://100.100.100.200/latest/meta-data", true, false},
+		{"https://[::1]/owner/name.git", true, false},
+		{"http://127.0.0.1/owner/name.git", false, true},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+
+		if test.publicOnly {
+			ctx = PublicOnly(ctx)
+		}
+
+		u, _ := url.Parse(test.url)
+		req := (&http.Request{URL: u}).WithContext(ctx)
+
+		if err := CheckRedirect(req, nil); (err == nil) != test.ok {
+			t.Errorf("Redirect to %s: expected allowed %v, got %v", test.url, test.ok, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"context"
+	"git-analyzer/pkg/tasks"
+	"net/http"
+	"net/url"
+)
+
+// BitbucketProvider is Bitbucket Cloud, Bitbucket Server has another API
+type BitbucketProvider struct {
+	web *url.URL
+	api *url.URL
+}
+
+func NewBitbucket() *BitbucketProvider {
+	return &BitbucketProvider{
+		web: mustParseURL("https://bitbucket.org"),
+		api: mustParseURL("https://api.bitbucket.org/2.0"),
+	}
+}
+
+type bitbucketRepo struct {
+	Size       int64 `json:"size"` // bytes
+	IsPrivate  bool  `json:"is_private"`
+	MainBranch *struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"` // empty repositories have none
+}
+
+func (p *BitbucketProvider) Kind() string {
+	return "bitbucket"
+}
+
+// user name of repository and workspace access tokens
+func (p *BitbucketProvider) TokenUser() string {
+	return "x-token-auth"
+}
+
+func (p *BitbucketProvider) Match(u *url.URL) (string, string, bool) {
+	return ownerAndName(p.web, u)
+}
+
+func (p *BitbucketProvider) Repo(ctx context.Context, owner, name, token string) (*Repo, error) {
+	data := &bitbucketRepo{}
+	header := http.Header{}
+
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	if err := getJSON(ctx, p.api.JoinPath("repositories", owner, name).String(), header, data); err != nil {
+		return nil, tasks.ScrubSecret(err, token)
+	}
+
+	repo := &Repo{
+		Provider: p,
+		Owner:    owner,
+		Name:     name,
+		Size:     data.Size,
+		Private:  data.IsPrivate,
+		CloneURL: p.web.JoinPath(owner, name+".git").String(),
+	}
+
+	if data.MainBranch != nil {
+		repo.DefaultBranch = data.MainBranch.Name
+	}
+
+	return repo, nil
+}
+
+func (p *BitbucketProvider) ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	return resolveRefByRemote(ctx, repo, ref, token)
+}
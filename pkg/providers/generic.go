@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"git-analyzer/pkg/netguard"
+	"git-analyzer/pkg/tasks"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// GenericProvider is any git host serving repositories over HTTPS,
+// it knows nothing but what the git protocol tells
+type GenericProvider struct {
+	base   *url.URL
+	suffix string // ".git" if the repository URL has it, servers may require the exact path
+}
+
+func NewGeneric(u *url.URL) *GenericProvider {
+	provider := &GenericProvider{base: &url.URL{Scheme: u.Scheme, Host: u.Host}}
+
+	if strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), ".git") {
+		provider.suffix = ".git"
+	}
+
+	return provider
+}
+
+func (p *GenericProvider) Kind() string {
+	return "git"
+}
+
+func (p *GenericProvider) TokenUser() string {
+	return "oauth2"
+}
+
+// the whole path is the repository, the last segment is its name
+func (p *GenericProvider) Match(u *url.URL) (string, string, bool) {
+	if u.Scheme != "https" {
+		return "", "", false
+	}
+
+	segments := relativePath(p.base, u)
+
+	if len(segments) < 2 {
+		return "", "", false
+	}
+
+	owner, name := strings.Join(segments[:len(segments)-1], "/"), segments[len(segments)-1]
+
+	if owner == "" || name == "" {
+		return "", "", false
+	}
+
+	return owner, name, true
+}
+
+// the size is not known before the transfer, the git protocol does not tell it,
+// the queue starts with a small reservation and grows it while the repository is cloned.
+// Hosts are reached only at public addresses, redirects and later resolutions included
+func (p *GenericProvider) Repo(ctx context.Context, owner, name, token string) (*Repo, error) {
+	if err := checkPublicHost(ctx, p.base.Hostname()); err != nil {
+		return nil, err
+	}
+
+	cloneURL := p.base.JoinPath(owner, name+p.suffix).String()
+	refs, private, err := listRepoRefs(netguard.PublicOnly(ctx), p, cloneURL, token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repo{
+		Provider:      p,
+		Owner:         owner,
+		Name:          name,
+		Private:       private,
+		DefaultBranch: defaultBranch(refs),
+		CloneURL:      cloneURL,
+		PublicOnly:    true,
+	}, nil
+}
+
+func (p *GenericProvider) ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	return resolveRefByRemote(netguard.PublicOnly(ctx), repo, ref, token)
+}
+
+// arbitrary URLs must not reach the network of the server, the host is rejected early
+// with a clear error, the connections are checked again by the git transport
+func checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+	if err != nil {
+		return fmt.Errorf("Unknown host %s", host)
+	}
+
+	for _, addr := range addrs {
+		if !netguard.IsPublicIP(addr.IP) {
+			return fmt.Errorf("Host %s is not allowed", host)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"context"
+	"git-analyzer/pkg/tasks"
+	"net/http"
+	"net/url"
+)
+
+// GiteaProvider is a Gitea or Forgejo instance, they share the API
+type GiteaProvider struct {
+	base *url.URL
+}
+
+func NewGitea(base *url.URL) *GiteaProvider {
+	return &GiteaProvider{base: base}
+}
+
+type giteaRepo struct {
+	Size          int64  `json:"size"` // KB
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+	CloneURL      string `json:"clone_url"`
+}
+
+func (p *GiteaProvider) Kind() string {
+	return "gitea"
+}
+
+// Gitea takes any user name with an access token
+func (p *GiteaProvider) TokenUser() string {
+	return "oauth2"
+}
+
+func (p *GiteaProvider) Match(u *url.URL) (string, string, bool) {
+	return ownerAndName(p.base, u)
+}
+
+func (p *GiteaProvider) Repo(ctx context.Context, owner, name, token string) (*Repo, error) {
+	data := &giteaRepo{}
+	header := http.Header{}
+
+	if token != "" {
+		header.Set("Authorization", "token "+token)
+	}
+
+	if err := getJSON(ctx, p.base.JoinPath("api/v1/repos", owner, name).String(), header, data); err != nil {
+		return nil, tasks.ScrubSecret(err, token)
+	}
+
+	return &Repo{
+		Provider:      p,
+		Owner:         owner,
+		Name:          name,
+		Size:          data.Size * 1024,
+		Private:       data.Private,
+		DefaultBranch: data.DefaultBranch,
+		CloneURL:      data.CloneURL,
+	}, nil
+}
+
+func (p *GiteaProvider) ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	return resolveRefByRemote(ctx, repo, ref, token)
+}
@@ -0,0 +1,299 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/tasks"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v63/github"
+)
+
+var commitRegexp = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// GitHub is github.com or GitHub Enterprise Server if it is configured,
+// its API is used with the server token when the user has none
+var GitHub = newGithubFromConfig()
+
+type GithubProvider struct {
+	webs      []*url.URL // web base URLs repositories are accepted from
+	apiURL    string     // empty for api.github.com
+	uploadURL string
+	client    *github.Client // with the server token, replaced only before the server starts
+
+	mu            sync.Mutex
+	app           *GithubApp                    // nil if the app is not configured
+	installations map[string]*installationToken // by lowercase owner/name, at most MAX_INSTALLATIONS
+}
+
+// NewGitHub returns the provider of GitHub Enterprise Server with the API and upload URLs
+// and the web URLs of its repositories, empty apiURL is api.github.com
+func NewGitHub(webs []*url.URL, apiURL, uploadURL, token string) (*GithubProvider, error) {
+	if uploadURL == "" {
+		uploadURL = apiURL
+	}
+
+	p := &GithubProvider{webs: webs, apiURL: apiURL, uploadURL: uploadURL}
+	client, err := p.newClient(token, serverCredential(token))
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = client
+
+	return p, nil
+}
+
+func newGithubFromConfig() *GithubProvider {
+	webs := []*url.URL{mustParseURL("https://github.com")}
+
+	if len(config.Vars.GithubURLs) > 0 {
+		webs = webs[:0]
+
+		for _, web := range config.Vars.GithubURLs {
+			webs = append(webs, mustParseURL(web))
+		}
+	}
+
+	p, err := NewGitHub(webs, config.Vars.GithubApiURL, config.Vars.GithubUploadURL, config.Vars.GithubApiPat)
+
+	if err != nil {
+		panic(fmt.Errorf("Invalid GitHub API URL: %w", err))
+	}
+
+	if config.Vars.GithubAppID != 0 {
+		app, err := LoadGithubApp(config.Vars.GithubAppID, config.Vars.GithubAppKeyPath)
+
+		if err != nil {
+			log.Printf("GitHub App is disabled, failed to load its key: %v", err)
+		} else {
+			p.UseApp(app)
+		}
+	}
+
+	return p
+}
+
+func serverCredential(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+
+	return "pat"
+}
+
+func (p *GithubProvider) Kind() string {
+	return "github"
+}
+
+func (p *GithubProvider) TokenUser() string {
+	// GitHub takes any user name with an access token
+	return "x-access-token"
+}
+
+func (p *GithubProvider) Match(u *url.URL) (string, string, bool) {
+	for _, web := range p.webs {
+		if owner, name, ok := ownerAndName(web, u); ok {
+			return owner, name, true
+		}
+	}
+
+	return "", "", false
+}
+
+// client of the API with the token, rate limits of server credentials are recorded
+// under the credential key, it is empty for user tokens
+func (p *GithubProvider) newClient(token, credential string) (*github.Client, error) {
+	httpClient := &http.Client{Transport: http.DefaultTransport}
+
+	if credential != "" {
+		httpClient.Transport = &rateLimitTransport{key: credential, base: http.DefaultTransport}
+	}
+
+	client := github.NewClient(httpClient)
+
+	if token != "" {
+		client = client.WithAuthToken(token)
+	}
+
+	if p.apiURL == "" {
+		return client, nil
+	}
+
+	return client.WithEnterpriseURLs(p.apiURL, p.uploadURL)
+}
+
+// client of the API acting for the user with the token, a server one if there is no token
+func (p *GithubProvider) clientFor(ctx context.Context, owner, name, token string) *github.Client {
+	if token == "" {
+		return p.serverClient(ctx, owner, name)
+	}
+
+	// the URLs were checked with the server client
+	client, _ := p.newClient(token, "")
+
+	return client
+}
+
+// CheckCredentials checks the server token and the app, invalid ones are not used,
+// must be called before the server starts
+func (p *GithubProvider) CheckCredentials(ctx context.Context) error {
+	var errs []error
+
+	if _, res, err := p.client.Users.Get(ctx, ""); err != nil && res != nil && res.StatusCode == http.StatusUnauthorized {
+		p.client, _ = p.newClient("", serverCredential(""))
+		errs = append(errs, errors.New("GitHub token is invalid, the API is called anonymously"))
+	}
+
+	p.mu.Lock()
+	app := p.app
+	p.mu.Unlock()
+
+	if app != nil {
+		jwt, err := app.jwt(time.Now())
+
+		if err == nil {
+			client, _ := p.newClient(jwt, "app_jwt")
+			_, _, err = client.Apps.Get(ctx, "")
+		}
+
+		if err != nil {
+			p.UseApp(nil)
+			errs = append(errs, fmt.Errorf("GitHub App is disabled: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *GithubProvider) Repo(ctx context.Context, owner, name, token string) (*Repo, error) {
+	repo, res, err := p.clientFor(ctx, owner, name, token).Repositories.Get(ctx, owner, name)
+
+	if errRateLimit, ok := getRateLimitError(err); ok {
+		return nil, errRateLimit
+	}
+
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return nil, ErrRepoNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	repoSize := int64(repo.GetSize()) * 1024 // bytes
+
+	if config.Vars.Debug {
+		log.Printf("Repo: %v, Size: %d MB\n", name, repoSize/1024/1024)
+	}
+
+	return &Repo{
+		Provider:      p,
+		Owner:         owner,
+		Name:          name,
+		Size:          repoSize,
+		Private:       repo.GetPrivate(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		CloneURL:      p.cloneURL(repo, owner, name),
+	}, nil
+}
+
+// the API tells the clone URL of the instance, the web one is assumed if it does not
+func (p *GithubProvider) cloneURL(repo *github.Repository, owner, name string) string {
+	if cloneURL := repo.GetCloneURL(); cloneURL != "" {
+		return cloneURL
+	}
+
+	return p.webs[0].JoinPath(owner, name).String()
+}
+
+func (p *GithubProvider) ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	client := p.clientFor(ctx, repo.Owner, repo.Name, token)
+
+	if ref == "" {
+		ref = repo.DefaultBranch
+	}
+
+	references := []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+	}
+
+	// branches and tags win over commits with the same prefix, as in git
+	for _, reference := range references {
+		if reference.Validate() != nil {
+			return tasks.Ref{}, fmt.Errorf("Invalid branch, tag or commit %q", ref)
+		}
+
+		// the API takes the name without the refs/ prefix
+		sha, found, err := p.fetchCommitSHA(ctx, client, repo, strings.TrimPrefix(reference.String(), "refs/"))
+
+		if err != nil {
+			return tasks.Ref{}, err
+		}
+
+		if found {
+			return tasks.Ref{Name: ref, Reference: reference, Commit: sha}, nil
+		}
+	}
+
+	if commitRegexp.MatchString(ref) {
+		sha, found, err := p.fetchCommitSHA(ctx, client, repo, ref)
+
+		if err != nil {
+			return tasks.Ref{}, err
+		}
+
+		if found {
+			return tasks.Ref{Name: ref, Commit: sha}, nil
+		}
+	}
+
+	return tasks.Ref{}, fmt.Errorf("%w: %q", ErrUnknownRef, ref)
+}
+
+// returns SHA of the commit the ref points to, found is false if there is no such commit
+func (p *GithubProvider) fetchCommitSHA(ctx context.Context, client *github.Client, repo *Repo, ref string) (sha string, found bool, err error) {
+	sha, res, err := client.Repositories.GetCommitSHA1(ctx, repo.Owner, repo.Name, ref, "")
+
+	if errRateLimit, ok := getRateLimitError(err); ok {
+		return "", false, errRateLimit
+	}
+
+	// unknown refs are 404, unknown commits are 422
+	if res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusUnprocessableEntity) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return sha, true, nil
+}
+
+func getRateLimitError(err error) (error, bool) {
+	var (
+		rle  *github.RateLimitError
+		arle *github.AbuseRateLimitError
+	)
+
+	switch {
+	case errors.As(err, &rle):
+		return fmt.Errorf("GitHub API rate limit exceeded. Try again in %s", rle.Rate.Reset), true
+	case errors.As(err, &arle):
+		return fmt.Errorf("GitHub API rate limit exceeded. Try again in %s", arle.RetryAfter), true
+	}
+
+	return nil, false
+}
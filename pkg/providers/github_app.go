@@ -0,0 +1,280 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+)
+
+const (
+	APP_JWT_TTL          = 9 * time.Minute  // GitHub accepts app tokens living up to 10 minutes
+	APP_JWT_CLOCK_DRIFT  = time.Minute      // the token is issued in the past in case the clocks differ
+	TOKEN_REFRESH_BEFORE = 5 * time.Minute  // installation tokens are rotated before they expire
+	NO_INSTALLATION_TTL  = 10 * time.Minute // repositories without the app installed are checked again after
+	MAX_INSTALLATIONS    = 1000             // repositories whose installation tokens are cached
+)
+
+// GithubApp authenticates as a GitHub App, the API is called with the tokens of its installations
+type GithubApp struct {
+	id  int64
+	key *rsa.PrivateKey
+}
+
+// installation token of a repository, token is empty if the app is not installed for it.
+// The token is fetched by the first caller, the others wait for ready to be closed
+type installationToken struct {
+	ready   chan struct{}
+	token   string
+	expires time.Time
+	err     error
+}
+
+func NewGithubApp(id int64, key *rsa.PrivateKey) *GithubApp {
+	return &GithubApp{id: id, key: key}
+}
+
+// LoadGithubApp reads the PEM private key of the app, PKCS #1 and PKCS #8 keys are accepted
+func LoadGithubApp(id int64, keyPath string) (*GithubApp, error) {
+	data, err := os.ReadFile(keyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("Private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewGithubApp(id, key), nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("Private key is not an RSA key")
+	}
+
+	return NewGithubApp(id, rsaKey), nil
+}
+
+// JWT signed with RS256 the app calls the API with to mint installation tokens
+func (this *GithubApp) jwt(now time.Time) (string, error) {
+	encode := func(value any) string {
+		data, _ := json.Marshal(value)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	payload := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(map[string]any{
+		"iat": now.Add(-APP_JWT_CLOCK_DRIFT).Unix(),
+		"exp": now.Add(APP_JWT_TTL).Unix(),
+		"iss": fmt.Sprint(this.id),
+	})
+
+	hash := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, this.key, crypto.SHA256, hash[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// UseApp makes the provider call the API with installation tokens of the app,
+// the server token is used for repositories the app is not installed for
+func (p *GithubProvider) UseApp(app *GithubApp) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.app = app
+	p.installations = make(map[string]*installationToken)
+}
+
+// installation token of the repository, empty if there is no app or it is not installed.
+// The installation is looked up for the repository, as the app may be installed only for some
+// repositories of the owner, so both tokens and missing installations are cached by the repository.
+// The mutex is not held during the API calls, a repository is refreshed at a time by a single call
+func (p *GithubProvider) installationToken(ctx context.Context, owner, name string) (string, error) {
+	key := installationKey(owner, name)
+	now := time.Now()
+
+	p.mu.Lock()
+	app := p.app
+
+	if app == nil {
+		p.mu.Unlock()
+		return "", nil
+	}
+
+	cached, ok := p.installations[key]
+
+	if ok && (!cached.fetched() || now.Add(TOKEN_REFRESH_BEFORE).Before(cached.expires)) {
+		p.mu.Unlock()
+
+		select {
+		case <-cached.ready:
+			return cached.token, cached.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	entry := &installationToken{ready: make(chan struct{})}
+	p.evictInstallations(now)
+	p.installations[key] = entry
+	p.mu.Unlock()
+
+	// the callers waiting for the token must not fail with the context of the first one
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), API_TIMEOUT)
+	defer cancel()
+
+	token, expires, err := p.fetchInstallationToken(fetchCtx, app, owner, name, now)
+
+	p.mu.Lock()
+	entry.token, entry.expires, entry.err = token, expires, err
+
+	// failures are not cached, the next call tries again
+	if err != nil && p.installations[key] == entry {
+		p.forgetInstallation(key)
+	}
+
+	p.mu.Unlock()
+	close(entry.ready)
+
+	return token, err
+}
+
+func installationKey(owner, name string) string {
+	return strings.ToLower(owner + "/" + name)
+}
+
+// remove the cached token with its rate limit, must be called with the mutex held
+func (p *GithubProvider) forgetInstallation(key string) {
+	delete(p.installations, key)
+	forgetRateLimit("app:" + key)
+}
+
+func (t *installationToken) fetched() bool {
+	select {
+	case <-t.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// make room for one more repository, expired tokens go first, then the ones expiring soonest.
+// must be called with the mutex held
+func (p *GithubProvider) evictInstallations(now time.Time) {
+	if len(p.installations) < MAX_INSTALLATIONS {
+		return
+	}
+
+	keys := make([]string, 0, len(p.installations))
+
+	// tokens being fetched are kept, their callers wait for them
+	for key, cached := range p.installations {
+		if cached.fetched() {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b string) int {
+		return p.installations[a].expires.Compare(p.installations[b].expires)
+	})
+
+	for _, key := range keys {
+		if len(p.installations) < MAX_INSTALLATIONS && !p.installations[key].expires.Before(now) {
+			return
+		}
+
+		p.forgetInstallation(key)
+	}
+}
+
+// look up the installation of the app for the repository and mint its token,
+// the token is empty if the app is not installed
+func (p *GithubProvider) fetchInstallationToken(ctx context.Context, app *GithubApp, owner, name string, now time.Time) (string, time.Time, error) {
+	jwt, err := app.jwt(now)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	client, err := p.newClient(jwt, "app_jwt")
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	installation, res, err := client.Apps.FindRepositoryInstallation(ctx, owner, name)
+
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return "", now.Add(TOKEN_REFRESH_BEFORE + NO_INSTALLATION_TTL), nil
+	}
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, _, err := client.Apps.CreateInstallationToken(ctx, installation.GetID(), nil)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token.GetToken(), token.GetExpiresAt().Time, nil
+}
+
+// client of the API with the most suitable server credential for the repository:
+// the installation token of the app if it has requests left, the server token otherwise
+func (p *GithubProvider) serverClient(ctx context.Context, owner, name string) *github.Client {
+	token, err := p.installationToken(ctx, owner, name)
+
+	if err != nil {
+		log.Printf("Failed to get the installation token of %s/%s, the server token is used: %v", owner, name, err)
+	}
+
+	if token == "" {
+		return p.client
+	}
+
+	credential := "app:" + installationKey(owner, name)
+
+	if rate, ok := rateLimitOf(credential); ok && rate.Remaining == 0 && time.Now().Before(rate.Reset) {
+		return p.client
+	}
+
+	client, err := p.newClient(token, credential)
+
+	if err != nil {
+		return p.client
+	}
+
+	return client
+}
@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGithubAppInstallationTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minted := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		switch {
+		case r.URL.Path == "/api/v3/repos/org/name/installation" || r.URL.Path == "/api/v3/app/installations/1/access_tokens":
+			// app endpoints take the JWT signed with the app key
+			parts := strings.Split(auth, ".")
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+			hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+			if len(parts) != 3 || rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if strings.HasSuffix(r.URL.Path, "/installation") {
+				w.Write([]byte(`{"id": 1}`))
+				return
+			}
+
+			minted++
+			fmt.Fprintf(w, `{"token": "installation", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case strings.HasSuffix(r.URL.Path, "/installation"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/api/v3/repos/org/name" && auth == "installation",
+			r.URL.Path == "/api/v3/repos/user/name" && auth == "pat":
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Header().Set("X-RateLimit-Reset", "1700000000")
+			w.Write([]byte(`{"default_branch": "main"}`))
+		case r.URL.Path == "/api/v3/repos/org/other" && auth == "pat":
+			w.Write([]byte(`{"default_branch": "main"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	github, err := NewGitHub([]*url.URL{mustParseURL("https://ghe.example.com")}, server.URL, "", "pat")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	github.UseApp(NewGithubApp(42, key))
+
+	// the app is installed only for some repositories of the owner
+	if _, err := github.Repo(context.Background(), "org", "other", ""); err != nil {
+		t.Fatalf("Expected the server token to be used: %v", err)
+	}
+
+	// the token is minted once and reused until it is about to expire
+	for range 2 {
+		if _, err := github.Repo(context.Background(), "org", "name", ""); err != nil {
+			t.Fatalf("Expected the installation token to be used: %v", err)
+		}
+	}
+
+	if minted != 1 {
+		t.Errorf("Expected one installation token to be minted, got %d", minted)
+	}
+
+	// the app is not installed for the user
+	if _, err := github.Repo(context.Background(), "user", "name", ""); err != nil {
+		t.Fatalf("Expected the server token to be used: %v", err)
+	}
+
+	credentials := make([]string, 0)
+
+	for _, rate := range RateLimits() {
+		if rate.Remaining == 4999 && rate.Reset.Unix() == 1700000000 {
+			credentials = append(credentials, rate.Credential)
+		}
+	}
+
+	if fmt.Sprint(credentials) != "[app pat]" {
+		t.Errorf("Expected rate limits of both credentials, got %v", credentials)
+	}
+}
+
+func TestGithubAppInstallationTokensSingleFlight(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lookups atomic.Int32
+
+	stalled := make(chan struct{})
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v3/repos/slow/name/installation":
+			lookups.Add(1)
+			stalled <- struct{}{}
+			<-release
+			w.Write([]byte(`{"id": 1}`))
+		case strings.HasSuffix(r.URL.Path, "/installation"):
+			w.Write([]byte(`{"id": 2}`))
+		case strings.HasSuffix(r.URL.Path, "/access_tokens"):
+			fmt.Fprintf(w, `{"token": "installation", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	github, err := NewGitHub([]*url.URL{mustParseURL("https://ghe.example.com")}, server.URL, "", "pat")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	github.UseApp(NewGithubApp(42, key))
+
+	results := make(chan string)
+
+	for range 3 {
+		go func() {
+			token, _ := github.installationToken(context.Background(), "slow", "name")
+			results <- token
+		}()
+	}
+
+	<-stalled
+
+	// the owner being refreshed does not block the others
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if token, err := github.installationToken(ctx, "org", "name"); token != "installation" || err != nil {
+		t.Errorf("Expected the token of another owner while one is stalled, got %q %v", token, err)
+	}
+
+	close(release)
+
+	for range 3 {
+		if token := <-results; token != "installation" {
+			t.Errorf("Expected the token shared by the waiting callers, got %q", token)
+		}
+	}
+
+	if lookups.Load() != 1 {
+		t.Errorf("Expected one installation lookup for concurrent callers, got %d", lookups.Load())
+	}
+
+	// the cache is bounded, the token expiring soonest is evicted
+	github.mu.Lock()
+	github.installations = make(map[string]*installationToken)
+
+	for i := range MAX_INSTALLATIONS {
+		ready := make(chan struct{})
+		close(ready)
+		github.installations[installationKey(fmt.Sprintf("owner%d", i), "name")] = &installationToken{ready: ready, expires: time.Now().Add(time.Hour + time.Duration(i)*time.Second)}
+	}
+
+	github.mu.Unlock()
+	github.installationToken(context.Background(), "new", "name")
+
+	if _, ok := github.installations[installationKey("owner0", "name")]; ok {
+		t.Errorf("Expected the token expiring soonest to be evicted")
+	}
+
+	if len(github.installations) > MAX_INSTALLATIONS {
+		t.Errorf("Expected at most %d cached repositories, got %d", MAX_INSTALLATIONS, len(github.installations))
+	}
+}
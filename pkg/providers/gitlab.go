@@ -0,0 +1,86 @@
+package providers
+
+import (
+	"context"
+	"git-analyzer/pkg/tasks"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// GitLabProvider is gitlab.com or a self-hosted GitLab instance
+type GitLabProvider struct {
+	base *url.URL
+}
+
+func NewGitLab(base *url.URL) *GitLabProvider {
+	return &GitLabProvider{base: base}
+}
+
+type gitlabProject struct {
+	DefaultBranch string `json:"default_branch"`
+	Visibility    string `json:"visibility"`
+	CloneURL      string `json:"http_url_to_repo"`
+	Statistics    *struct {
+		RepositorySize int64 `json:"repository_size"`
+	} `json:"statistics"` // only for members with at least the reporter role
+}
+
+func (p *GitLabProvider) Kind() string {
+	return "gitlab"
+}
+
+func (p *GitLabProvider) TokenUser() string {
+	return "oauth2"
+}
+
+// projects are in nested groups, the path of the project ends before the "-" segment
+func (p *GitLabProvider) Match(u *url.URL) (string, string, bool) {
+	segments := relativePath(p.base, u)
+
+	if i := slices.Index(segments, "-"); i != -1 {
+		segments = segments[:i]
+	}
+
+	if len(segments) < 2 || slices.Contains(segments, "") {
+		return "", "", false
+	}
+
+	return strings.Join(segments[:len(segments)-1], "/"), segments[len(segments)-1], true
+}
+
+func (p *GitLabProvider) Repo(ctx context.Context, owner, name, token string) (*Repo, error) {
+	project := &gitlabProject{}
+	header := http.Header{}
+
+	if token != "" {
+		header.Set("PRIVATE-TOKEN", token)
+	}
+
+	// the project is addressed by its encoded path
+	endpoint := p.base.JoinPath("api/v4/projects").String() + "/" + url.PathEscape(owner+"/"+name) + "?statistics=true"
+
+	if err := getJSON(ctx, endpoint, header, project); err != nil {
+		return nil, tasks.ScrubSecret(err, token)
+	}
+
+	repo := &Repo{
+		Provider:      p,
+		Owner:         owner,
+		Name:          name,
+		Private:       project.Visibility != "public", // internal projects require to sign in too
+		DefaultBranch: project.DefaultBranch,
+		CloneURL:      project.CloneURL,
+	}
+
+	if project.Statistics != nil {
+		repo.Size = project.Statistics.RepositorySize
+	}
+
+	return repo, nil
+}
+
+func (p *GitLabProvider) ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	return resolveRefByRemote(ctx, repo, ref, token)
+}
@@ -0,0 +1,191 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/tasks"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const API_TIMEOUT = 10 * time.Second // timeout of a single request to the hosting API
+
+var (
+	ErrRepoNotFound = errors.New("Repository does not exist")
+	ErrUnknownRef   = errors.New("Branch, tag or commit not found")
+)
+
+// Repo is the metadata of a repository resolved by its provider
+type Repo struct {
+	Provider      RepoProvider
+	Owner         string // owner, workspace or group path, e.g. "group/subgroup" on GitLab
+	Name          string
+	Size          int64 // size in bytes, 0 if the host does not tell it
+	Private       bool  // the repository requires a token to be read
+	DefaultBranch string
+	CloneURL      string // HTTPS clone URL
+	PublicOnly    bool   // the host was given by the user, it may be reached only at public addresses
+}
+
+// RepoProvider is a git hosting repositories are analyzed from
+type RepoProvider interface {
+	// Kind is the name of the hosting software, e.g. "github"
+	Kind() string
+
+	// Match returns the owner and the name of the repository
+	// if the URL points to a repository on this host
+	Match(u *url.URL) (owner, name string, ok bool)
+
+	// Repo resolves the repository metadata, token is the access token
+	// of the user for private repositories, empty for public ones
+	Repo(ctx context.Context, owner, name, token string) (*Repo, error)
+
+	// ResolveRef resolves the branch, tag or commit of the repository to the commit SHA,
+	// an empty ref is the default branch
+	ResolveRef(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error)
+
+	// TokenUser is the user name to clone with the access token over HTTPS
+	TokenUser() string
+}
+
+// Providers are the known hosts, repositories on other hosts are cloned by their URL
+var Providers = defaultProviders()
+
+func defaultProviders() []RepoProvider {
+	providers := []RepoProvider{
+		GitHub,
+		NewGitLab(mustParseURL("https://gitlab.com")),
+		NewBitbucket(),
+		NewGitea(mustParseURL("https://codeberg.org")),
+	}
+
+	for _, base := range config.Vars.GitlabURLs {
+		providers = append(providers, NewGitLab(mustParseURL(base)))
+	}
+
+	for _, base := range config.Vars.GiteaURLs {
+		providers = append(providers, NewGitea(mustParseURL(base)))
+	}
+
+	return providers
+}
+
+func mustParseURL(rawurl string) *url.URL {
+	u, err := url.Parse(strings.TrimSuffix(rawurl, "/"))
+
+	if err != nil || u.Host == "" {
+		panic(fmt.Errorf("Invalid git host URL %q", rawurl))
+	}
+
+	return u
+}
+
+// Parse finds the provider of the repository URL and returns the repository owner and name
+func Parse(rawurl string) (RepoProvider, string, string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid url: %s", err)
+	}
+
+	if u.Host == "" {
+		return nil, "", "", fmt.Errorf("Url must contain the host: %s", rawurl)
+	}
+
+	for _, provider := range Providers {
+		if owner, name, ok := provider.Match(u); ok {
+			return provider, owner, name, nil
+		}
+	}
+
+	generic := NewGeneric(u)
+
+	if owner, name, ok := generic.Match(u); ok {
+		return generic, owner, name, nil
+	}
+
+	return nil, "", "", fmt.Errorf("Url must contain owner and repo: %s", rawurl)
+}
+
+// path segments of the URL below the base one, nil if the URL is on another host
+func relativePath(base, u *url.URL) []string {
+	if !strings.EqualFold(base.Host, u.Host) {
+		return nil
+	}
+
+	path, ok := strings.CutPrefix(u.Path, base.Path+"/")
+
+	if !ok {
+		return nil
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(segments) > 0 {
+		segments[len(segments)-1] = strings.TrimSuffix(segments[len(segments)-1], ".git")
+	}
+
+	return segments
+}
+
+// owner and name of the URL with the "/owner/name" path, the rest of the path is ignored
+func ownerAndName(base, u *url.URL) (string, string, bool) {
+	segments := relativePath(base, u)
+
+	if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+		return "", "", false
+	}
+
+	return segments[0], strings.TrimSuffix(segments[1], ".git"), true
+}
+
+// error of a hosting API response
+type apiError struct {
+	status int
+	url    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("Unexpected status %d of %s", e.status, e.url)
+}
+
+// get the JSON of the hosting API into the value, ErrRepoNotFound is returned
+// for 404, hosts answer with it for private repositories without a token too
+func getJSON(ctx context.Context, url string, header http.Header, value any) error {
+	ctx, cancel := context.WithTimeout(ctx, API_TIMEOUT)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrRepoNotFound
+	case res.StatusCode != http.StatusOK:
+		return &apiError{status: res.StatusCode, url: url}
+	}
+
+	return json.NewDecoder(res.Body).Decode(value)
+}
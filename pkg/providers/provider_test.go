@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url   string
+		kind  string
+		owner string
+		name  string
+	}{
+		{"https://github.com/owner/name", "github", "owner", "name"},
+		{"https://github.com/owner/name.git", "github", "owner", "name"},
+		{"https://github.com/owner/name/tree/main/pkg", "github", "owner", "name"},
+		{"https://gitlab.com/group/subgroup/name/-/tree/main", "gitlab", "group/subgroup", "name"},
+		{"https://gitlab.com/group/name.git", "gitlab", "group", "name"},
+		{"https://bitbucket.org/workspace/name/src/main", "bitbucket", "workspace", "name"},
+		{"https://codeberg.org/owner/name", "gitea", "owner", "name"},
+		{"https://git.example.com/pub/scm/name.git", "git", "pub/scm", "name"},
+		{"https://github.com/owner", "", "", ""},
+		{"http://git.example.com/owner/name", "", "", ""},
+		{"github.com/owner/name", "", "", ""},
+	}
+
+	for _, test := range tests {
+		provider, owner, name, err := Parse(test.url)
+
+		if test.kind == "" {
+			if err == nil {
+				t.Errorf("Parse(%q): expected error, got %s %s/%s", test.url, provider.Kind(), owner, name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.url, err)
+			continue
+		}
+
+		if provider.Kind() != test.kind || owner != test.owner || name != test.name {
+			t.Errorf("Parse(%q) = %s %s/%s, expected %s %s/%s", test.url, provider.Kind(), owner, name, test.kind, test.owner, test.name)
+		}
+	}
+}
+
+func TestAPIProviders(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/group%2Fsub%2Fname": `{"default_branch": "main", "visibility": "private", "http_url_to_repo": "https://gitlab/group/sub/name.git", "statistics": {"repository_size": 2048}}`,
+		"/api/v1/repos/owner/name":            `{"default_branch": "dev", "private": false, "clone_url": "https://gitea/owner/name.git", "size": 2}`,
+		"/repositories/workspace/name":        `{"size": 4096, "is_private": true, "mainbranch": {"name": "master"}}`,
+	}
+
+	var authorization string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+
+		if response, ok := responses[r.URL.EscapedPath()]; ok {
+			w.Write([]byte(response))
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	base := mustParseURL(server.URL)
+	bitbucket := NewBitbucket()
+	bitbucket.api = base
+
+	tests := []struct {
+		provider      RepoProvider
+		owner         string
+		authorization string
+		expected      Repo
+	}{
+		{NewGitLab(base), "group/sub", "token", Repo{Size: 2048, Private: true, DefaultBranch: "main", CloneURL: "https://gitlab/group/sub/name.git"}},
+		{NewGitea(base), "owner", "token token", Repo{Size: 2048, DefaultBranch: "dev", CloneURL: "https://gitea/owner/name.git"}},
+		{bitbucket, "workspace", "Bearer token", Repo{Size: 4096, Private: true, DefaultBranch: "master", CloneURL: "https://bitbucket.org/workspace/name.git"}},
+	}
+
+	for _, test := range tests {
+		repo, err := test.provider.Repo(context.Background(), test.owner, "name", "token")
+
+		if err != nil {
+			t.Errorf("%s: %v", test.provider.Kind(), err)
+			continue
+		}
+
+		if authorization != test.authorization {
+			t.Errorf("%s: expected token to be sent as %q, got %q", test.provider.Kind(), test.authorization, authorization)
+		}
+
+		test.expected.Provider, test.expected.Owner, test.expected.Name = test.provider, test.owner, "name"
+
+		if *repo != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.provider.Kind(), test.expected, *repo)
+		}
+
+		if _, err := test.provider.Repo(context.Background(), test.owner, "missing", ""); !errors.Is(err, ErrRepoNotFound) {
+			t.Errorf("%s: expected ErrRepoNotFound, got %v", test.provider.Kind(), err)
+		}
+	}
+}
+
+func TestGitHubEnterprise(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/name":
+			w.Write([]byte(`{"size": 1, "private": true, "default_branch": "main", "clone_url": "https://ghe.example.com/owner/name.git"}`))
+		case "/api/v3/repos/owner/name/commits/heads/main":
+			w.Write([]byte("0123456789abcdef0123456789abcdef01234567"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	github, err := NewGitHub([]*url.URL{mustParseURL("https://ghe.example.com")}, server.URL, "", "token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := github.Match(mustParseURL("https://github.com/owner/name")); ok {
+		t.Errorf("Expected github.com not to be accepted")
+	}
+
+	owner, name, ok := github.Match(mustParseURL("https://ghe.example.com/owner/name"))
+
+	if !ok || owner != "owner" || name != "name" {
+		t.Fatalf("Expected the enterprise URL to be accepted, got %s/%s", owner, name)
+	}
+
+	repo, err := github.Repo(context.Background(), owner, name, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !repo.Private || repo.Size != 1024 || repo.CloneURL != "https://ghe.example.com/owner/name.git" {
+		t.Errorf("Unexpected repository %+v", *repo)
+	}
+
+	ref, err := github.ResolveRef(context.Background(), repo, "", "")
+
+	if err != nil || ref.Name != "main" || ref.Reference != "refs/heads/main" || ref.Commit != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("Unexpected ref %+v, %v", ref, err)
+	}
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is the API rate limit of a server credential as of its last response
+type RateLimit struct {
+	Credential string // "pat", "anonymous", "app_jwt" or "app" for installation tokens
+	Limit      int
+	Remaining  int
+	Reset      time.Time
+}
+
+// rate limits by credential key, the credential name or "app:<owner>/<name>" for installation tokens.
+// Installation ones are forgotten with their tokens
+var rateLimits = struct {
+	mu    sync.Mutex
+	byKey map[string]RateLimit
+}{byKey: make(map[string]RateLimit)}
+
+// RateLimits returns the last known rate limits of server credentials ordered by their names,
+// installation tokens are reported as one credential by the one with the fewest requests left
+func RateLimits() []RateLimit {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	byCredential := make(map[string]RateLimit)
+
+	for _, rate := range rateLimits.byKey {
+		if other, ok := byCredential[rate.Credential]; !ok || rate.Remaining < other.Remaining {
+			byCredential[rate.Credential] = rate
+		}
+	}
+
+	list := make([]RateLimit, 0, len(byCredential))
+
+	for _, rate := range byCredential {
+		list = append(list, rate)
+	}
+
+	slices.SortFunc(list, func(a, b RateLimit) int {
+		return strings.Compare(a.Credential, b.Credential)
+	})
+
+	return list
+}
+
+func rateLimitOf(key string) (RateLimit, bool) {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	rate, ok := rateLimits.byKey[key]
+
+	return rate, ok
+}
+
+func forgetRateLimit(key string) {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	delete(rateLimits.byKey, key)
+}
+
+// records the rate limit headers of the credential responses,
+// GitHub Enterprise Server without rate limits sends none
+type rateLimitTransport struct {
+	key  string // credential key, the name of the credential is the part before ":"
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		return res, err
+	}
+
+	limit, errLimit := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, errReset := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	if errLimit == nil && errRemaining == nil && errReset == nil {
+		rateLimits.mu.Lock()
+		credential, _, _ := strings.Cut(t.key, ":")
+		rateLimits.byKey[t.key] = RateLimit{
+			Credential: credential,
+			Limit:      limit,
+			Remaining:  remaining,
+			Reset:      time.Unix(reset, 0),
+		}
+		rateLimits.mu.Unlock()
+	}
+
+	return res, nil
+}
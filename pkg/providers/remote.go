@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/tasks"
+	"regexp"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+var fullCommitRegexp = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// BasicAuth returns the credentials to clone from the provider with the token, nil if there is no token
+func BasicAuth(provider RepoProvider, token string) transport.AuthMethod {
+	if token == "" {
+		return nil
+	}
+
+	return &githttp.BasicAuth{Username: provider.TokenUser(), Password: token}
+}
+
+// refs advertised by the remote like git ls-remote does, peeled tags have the ^{} suffix
+func listRefs(ctx context.Context, url string, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	ctx, cancel := context.WithTimeout(ctx, API_TIMEOUT)
+	defer cancel()
+
+	remote := gogit.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	return remote.ListContext(ctx, &gogit.ListOptions{Auth: auth, PeelingOption: gogit.AppendPeeled})
+}
+
+// list the refs of the repository anonymously, then with the token if the repository is not public.
+// private tells whether the token was needed
+func listRepoRefs(ctx context.Context, provider RepoProvider, url, token string) (refs []*plumbing.Reference, private bool, err error) {
+	refs, err = listRefs(ctx, url, nil)
+
+	// hosts hide private repositories from anonymous users
+	hidden := errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrRepositoryNotFound)
+
+	if hidden && token != "" {
+		private = true
+		refs, err = listRefs(ctx, url, BasicAuth(provider, token))
+	}
+
+	switch {
+	case errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed):
+		return nil, false, ErrRepoNotFound
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return nil, false, errors.New("Repository is empty")
+	case err != nil:
+		return nil, false, tasks.ScrubSecret(err, token)
+	}
+
+	return refs, private, nil
+}
+
+// branch HEAD of the remote points to, empty if there is none
+func defaultBranch(refs []*plumbing.Reference) string {
+	var head *plumbing.Reference
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+
+	switch {
+	case head == nil:
+		return ""
+	case head.Type() == plumbing.SymbolicReference:
+		return head.Target().Short()
+	}
+
+	// the remote did not tell the target of HEAD, it is the branch with the same commit
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			return ref.Name().Short()
+		}
+	}
+
+	return ""
+}
+
+// resolve the branch, tag or full commit SHA among the remote refs,
+// annotated tags are resolved to their commits
+func resolveRemoteRef(refs []*plumbing.Reference, ref string) (tasks.Ref, error) {
+	byName := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+
+	for _, remoteRef := range refs {
+		byName[remoteRef.Name()] = remoteRef.Hash()
+	}
+
+	branch := plumbing.NewBranchReferenceName(ref)
+
+	if hash, ok := byName[branch]; ok {
+		return tasks.Ref{Name: ref, Reference: branch, Commit: hash.String()}, nil
+	}
+
+	tag := plumbing.NewTagReferenceName(ref)
+
+	if hash, ok := byName[tag]; ok {
+		if peeled, ok := byName[tag+"^{}"]; ok {
+			hash = peeled
+		}
+
+		return tasks.Ref{Name: ref, Reference: tag, Commit: hash.String()}, nil
+	}
+
+	// a commit can be checked only by fetching it, it is cloned as is
+	if fullCommitRegexp.MatchString(ref) {
+		return tasks.Ref{Name: ref, Commit: strings.ToLower(ref)}, nil
+	}
+
+	return tasks.Ref{}, fmt.Errorf("%w: %q, commits must be given by the full SHA", ErrUnknownRef, ref)
+}
+
+// resolve the ref of the repository on a host without a refs API
+func resolveRefByRemote(ctx context.Context, repo *Repo, ref, token string) (tasks.Ref, error) {
+	refs, _, err := listRepoRefs(ctx, repo.Provider, repo.CloneURL, token)
+
+	if err != nil {
+		return tasks.Ref{}, err
+	}
+
+	if ref == "" {
+		ref = repo.DefaultBranch
+
+		if ref == "" {
+			ref = defaultBranch(refs)
+		}
+	}
+
+	return resolveRemoteRef(refs, ref)
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestResolveRemoteRef(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, _ := repo.Worktree()
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commits := make([]plumbing.Hash, 0, 2)
+
+	for _, content := range []string{"first", "second"} {
+		os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0600)
+		worktree.Add("file.txt")
+		hash, err := worktree.Commit(content, &gogit.CommitOptions{Author: signature})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commits = append(commits, hash)
+	}
+
+	// annotated tag is resolved to its commit, not the tag object
+	_, err = repo.CreateTag("v1", commits[0], &gogit.CreateTagOptions{Tagger: signature, Message: "v1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, private, err := listRepoRefs(context.Background(), GitHub, dir, "")
+
+	if err != nil || private {
+		t.Fatalf("Unexpected result of listing refs: %v, private %v", err, private)
+	}
+
+	head, _ := repo.Head()
+
+	if branch := defaultBranch(refs); branch != head.Name().Short() {
+		t.Errorf("Expected default branch %s, got %s", head.Name().Short(), branch)
+	}
+
+	tests := []struct {
+		ref       string
+		reference plumbing.ReferenceName
+		commit    plumbing.Hash
+	}{
+		{head.Name().Short(), head.Name(), commits[1]},
+		{"v1", "refs/tags/v1", commits[0]},
+		{commits[0].String(), "", commits[0]},
+	}
+
+	for _, test := range tests {
+		ref, err := resolveRemoteRef(refs, test.ref)
+
+		if err != nil {
+			t.Errorf("Resolve %s: %v", test.ref, err)
+			continue
+		}
+
+		if ref.Name != test.ref || ref.Reference != test.reference || ref.Commit != test.commit.String() {
+			t.Errorf("Resolve %s: unexpected %+v", test.ref, ref)
+		}
+	}
+
+	if _, err := resolveRemoteRef(refs, "missing"); !errors.Is(err, ErrUnknownRef) {
+		t.Errorf("Expected ErrUnknownRef, got %v", err)
+	}
+
+	if _, _, err := listRepoRefs(context.Background(), GitHub, filepath.Join(dir, "missing"), ""); !errors.Is(err, ErrRepoNotFound) {
+		t.Errorf("Expected ErrRepoNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/netguard"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const (
+	SIZE_CHECK_INTERVAL      = 250 * time.Millisecond // how often the clone directory is measured
+	UNKNOWN_SIZE_RESERVATION = 64 << 20               // bytes first reserved for a repository the host does not tell the size of
+)
+
+var ErrRepoTooLarge = errors.New("Repository is too large")
+
+// sizeBudget aborts a clone once the repository takes more than the space reserved for it.
+// Hosts report stale sizes or leave out LFS objects, so the reported size is not trusted
+type sizeBudget struct {
+	mu       sync.Mutex
+	limit    int64                  // bytes, 0 if there is no limit
+	grow     func(used int64) int64 // raises the limit for the used bytes and returns it, nil if the limit is fixed
+	dir      string
+	received atomic.Int64 // bytes received from the remote over HTTP
+	cancel   context.CancelCauseFunc
+}
+
+type sizeBudgetKey struct{}
+
+// watch the clone into the dir, the returned context is canceled with the exceeded limit
+// as the cause, stop must be called once the clone is over
+func watchSize(parent context.Context, dir string, limit int64, grow func(used int64) int64) (ctx context.Context, budget *sizeBudget, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	budget = &sizeBudget{limit: limit, grow: grow, dir: dir, cancel: cancel}
+
+	if limit <= 0 {
+		return ctx, budget, func() { cancel(nil) }
+	}
+
+	ctx = context.WithValue(ctx, sizeBudgetKey{}, budget)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(SIZE_CHECK_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				budget.check(dirSize(dir))
+			}
+		}
+	}()
+
+	return ctx, budget, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+// check the used space against the limit, the clone is aborted if it is exceeded
+// and the limit can not grow
+func (this *sizeBudget) check(used int64) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.limit <= 0 || used <= this.limit {
+		return nil
+	}
+
+	if this.grow != nil {
+		if this.limit = this.grow(used); used <= this.limit {
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("%w, it takes more than %d MB", ErrRepoTooLarge, this.limit/1048576)
+	this.cancel(err)
+
+	return err
+}
+
+// the error of the aborted clone, nil if the clone was not aborted for its size
+func (this *sizeBudget) err(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrRepoTooLarge) {
+		return cause
+	}
+
+	return nil
+}
+
+// size of all files in the dir in bytes
+func dirSize(dir string) int64 {
+	var size int64
+
+	filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+		// the clone creates and renames files during the walk
+		if err != nil || e.IsDir() {
+			return nil
+		}
+
+		if fileInfo, err := e.Info(); err == nil {
+			size += fileInfo.Size()
+		}
+
+		return nil
+	})
+
+	return size
+}
+
+// counts the bytes of responses to requests made with a watched context,
+// the pack is aborted as soon as it exceeds the limit rather than on the next check.
+// Public only requests are sent with the transport checking their addresses
+type sizeBudgetTransport struct {
+	base http.RoundTripper
+}
+
+func (t *sizeBudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+
+	if netguard.IsPublicOnly(req.Context()) {
+		base = publicTransport
+	}
+
+	res, err := base.RoundTrip(req)
+
+	if budget, ok := req.Context().Value(sizeBudgetKey{}).(*sizeBudget); ok && err == nil {
+		res.Body = &countingBody{ReadCloser: res.Body, budget: budget}
+	}
+
+	return res, err
+}
+
+// transport of public only requests, it has its own connections
+// so that the ones to private hosts of trusted requests are never reused
+var publicTransport = netguard.NewTransport()
+
+type countingBody struct {
+	io.ReadCloser
+	budget *sizeBudget
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if errBudget := b.budget.check(b.budget.received.Add(int64(n))); errBudget != nil {
+		return n, errBudget
+	}
+
+	return n, err
+}
+
+func init() {
+	transport := githttp.NewClient(&http.Client{
+		Transport:     &sizeBudgetTransport{base: http.DefaultTransport},
+		CheckRedirect: netguard.CheckRedirect,
+	})
+
+	client.InstallProtocol("http", transport)
+	client.InstallProtocol("https", transport)
+}
@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"git-analyzer/pkg/netguard"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git-analyzer/pkg/analyzer"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestCloneSizeBudget(t *testing.T) {
+	origin := t.TempDir()
+	repo, err := gogit.PlainInit(origin, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random data is not compressed, the clone takes twice its size with the checkout
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	if err := os.WriteFile(filepath.Join(origin, "data.bin"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	worktree, _ := repo.Worktree()
+
+	if _, err := worktree.Add("data.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = worktree.Commit("data", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := RepoTaskQueue
+	defer func() { RepoTaskQueue = queue }()
+
+	tests := []struct {
+		size        int64 // reported size, half of the reservation
+		maxRepoSize int64
+		reserved    int64 // first reservation if it is not the one of the size
+		freeMemory  int64 // free disk space above the required one
+		tooLarge    bool
+	}{
+		{256 << 10, 8 << 20, 0, 8 << 20, true},
+		{2 << 20, 8 << 20, 0, 8 << 20, false},
+		// the host does not tell the size, the reservation grows up to the size limit
+		{0, 512 << 10, 0, 8 << 20, true},
+		{0, 8 << 20, 0, 8 << 20, false},
+		{0, 8 << 20, 256 << 10, 8 << 20, false},
+		// the disk has no space for more
+		{0, 8 << 20, 256 << 10, 512 << 10, true},
+	}
+
+	for _, test := range tests {
+		q := newTestQueue()
+		q.MaxRepoSize = test.maxRepoSize
+		q.maxDiskSize = REQUIRED_LIMIT + test.freeMemory
+		q.freeMemory = q.maxDiskSize
+		q.rootDir = t.TempDir()
+		RepoTaskQueue = q
+
+		id, _ := q.Add(&RepoTask{Size: test.size, URL: origin, Opts: &analyzer.Options{}})
+		task, _ := q.GetTask(id)
+		reservation := task.reservation()
+
+		if test.reserved != 0 {
+			reservation = test.reserved
+		}
+
+		if err := q.reserve(context.Background(), reservation); err != nil {
+			t.Fatal(err)
+		}
+
+		task.reserved.Store(reservation)
+
+		dir, _, err := q.writeRepo(task)
+		os.RemoveAll(dir)
+
+		// the grown reservation is held by the task until it is released
+		if q.reserved != task.reserved.Load() || q.freeMemory != q.maxDiskSize-q.reserved {
+			t.Errorf("Size %d of %d: expected the queue to hold the reservation %d, got %d reserved, %d free",
+				test.size, test.maxRepoSize, task.reserved.Load(), q.reserved, q.freeMemory)
+		}
+
+		if test.size == 0 && !test.tooLarge && task.reserved.Load() <= reservation && reservation < 2<<20 {
+			t.Errorf("Size %d of %d: expected the reservation %d to grow", test.size, test.maxRepoSize, reservation)
+		}
+
+		if tooLarge := errors.Is(err, ErrRepoTooLarge); tooLarge != test.tooLarge {
+			t.Errorf("Size %d of %d: expected too large %v, got %v", test.size, test.maxRepoSize, test.tooLarge, err)
+		}
+
+		if test.tooLarge && ErrorCodeOf(err) != ERROR_TOO_LARGE {
+			t.Errorf("Size %d of %d: expected %s error code, got %s", test.size, test.maxRepoSize, ERROR_TOO_LARGE, ErrorCodeOf(err))
+		}
+
+		if !test.tooLarge && err != nil {
+			t.Errorf("Size %d of %d: unexpected error %v", test.size, test.maxRepoSize, err)
+		}
+	}
+}
+
+func TestPublicOnlyClone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	repoURL := server.URL + "/owner/name.git"
+
+	if err := (Ref{}).clone(context.Background(), t.TempDir(), repoURL, nil); err == nil || errors.Is(err, netguard.ErrPrivateAddress) {
+		t.Errorf("Expected trusted requests to reach the local host, got %v", err)
+	}
+
+	if err := (Ref{}).clone(netguard.PublicOnly(context.Background()), t.TempDir(), repoURL, nil); !errors.Is(err, netguard.ErrPrivateAddress) {
+		t.Errorf("Expected public only requests not to reach the local host, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/netguard"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// ErrorCode tells clients why the task failed
+type ErrorCode string
+
+const (
+	ERROR_NETWORK    ErrorCode = "network"    // the repository host is unreachable, retries did not help
+	ERROR_AUTH       ErrorCode = "auth"       // the repository is private or requires credentials
+	ERROR_NOT_FOUND  ErrorCode = "not_found"  // the repository does not exist
+	ERROR_EMPTY      ErrorCode = "empty"      // the repository has no commits
+	ERROR_TOO_LARGE  ErrorCode = "too_large"  // the repository does not fit on the disk
+	ERROR_CANCELED   ErrorCode = "canceled"   // canceled by the client
+	ERROR_EXPIRED    ErrorCode = "expired"    // the client stopped polling the status
+	ERROR_INTERNAL   ErrorCode = "internal"   // any other error
+	ERROR_UNEXPECTED ErrorCode = "unexpected" // the host answered with an unexpected status
+	ERROR_TIMEOUT    ErrorCode = "timeout"    // a phase of the task did not finish in time
+	ERROR_FORBIDDEN  ErrorCode = "forbidden"  // the repository host is not allowed, it is not a public address
+)
+
+// Phase is a step of the analysis with its own deadline
+type Phase string
+
+const (
+	PHASE_METADATA Phase = "metadata lookup" // the repository and the ref are resolved by the host API
+	PHASE_FETCH    Phase = "fetch"           // the repository is cloned, retries included
+	PHASE_ANALYSIS Phase = "analysis"
+)
+
+const (
+	CLONE_RETRIES     = 3               // clone attempts after the first one for transient errors
+	CLONE_RETRY_DELAY = 1 * time.Second // delay before the first retry, doubled for each next one
+)
+
+// TaskError is an error of the task with its code
+type TaskError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *TaskError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+func newTaskError(code ErrorCode, err error) *TaskError {
+	return &TaskError{Code: code, Err: err}
+}
+
+// PhaseTimeoutError tells which phase ran out of time
+type PhaseTimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("Repository %s timed out after %s", e.Phase, e.Timeout)
+}
+
+// WithPhaseTimeout limits the phase to the timeout, there is no limit if it is 0
+func WithPhaseTimeout(ctx context.Context, phase Phase, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, timeout, &PhaseTimeoutError{Phase: phase, Timeout: timeout})
+}
+
+// PhaseTimeoutOf returns the timeout error of the phase if ctx is done because of it, nil otherwise
+func PhaseTimeoutOf(ctx context.Context) error {
+	var timeoutErr *PhaseTimeoutError
+
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return newTaskError(ERROR_TIMEOUT, timeoutErr)
+	}
+
+	return nil
+}
+
+// error with a secret removed from the message, errors.Is and errors.As still see the original one
+type scrubbedError struct {
+	message string
+	err     error
+}
+
+func (e *scrubbedError) Error() string {
+	return e.message
+}
+
+func (e *scrubbedError) Unwrap() error {
+	return e.err
+}
+
+// ScrubSecret returns err with every occurrence of the secret masked in its message
+func ScrubSecret(err error, secret string) error {
+	if err == nil || secret == "" || !strings.Contains(err.Error(), secret) {
+		return err
+	}
+
+	return &scrubbedError{message: strings.ReplaceAll(err.Error(), secret, "***"), err: err}
+}
+
+// ErrorCodeOf returns the code of the task error, empty if err is nil
+func ErrorCodeOf(err error) ErrorCode {
+	var taskErr *TaskError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &taskErr):
+		return taskErr.Code
+	case errors.Is(err, ErrTaskCanceled):
+		return ERROR_CANCELED
+	case errors.Is(err, ErrTaskExpired):
+		return ERROR_EXPIRED
+	case errors.Is(err, errMemoryLimit):
+		return ERROR_TOO_LARGE
+	}
+
+	return ERROR_INTERNAL
+}
+
+// classify a clone error, transient errors are worth retrying
+func classifyCloneError(err error) (code ErrorCode, transient bool) {
+	var (
+		timeoutErr *PhaseTimeoutError
+		unexpected *plumbing.UnexpectedError
+		netErr     net.Error
+	)
+
+	switch {
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return ERROR_TIMEOUT, false
+	case errors.Is(err, context.Canceled):
+		return ERROR_CANCELED, false
+	case errors.Is(err, netguard.ErrPrivateAddress):
+		// wrapped in a network error, but retries reach the same address
+		return ERROR_FORBIDDEN, false
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return ERROR_NOT_FOUND, false
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		return ERROR_AUTH, false
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return ERROR_EMPTY, false
+	case errors.As(err, &unexpected):
+		var httpErr *githttp.Err
+
+		if errors.As(unexpected.Err, &httpErr) {
+			status := httpErr.StatusCode()
+			transient := status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+
+			if transient {
+				return ERROR_NETWORK, true
+			}
+		}
+
+		return ERROR_UNEXPECTED, false
+	case errors.As(err, &netErr),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return ERROR_NETWORK, true
+	}
+
+	return ERROR_INTERNAL, false
+}
@@ -0,0 +1,355 @@
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+const (
+	MAX_QUEUED_TASKS      = 20               // tasks waiting for a worker, new ones are rejected above it
+	DURATION_SAMPLES      = 20               // recent task durations used for estimates
+	DEFAULT_TASK_DURATION = 10 * time.Second // estimate used before any task is done
+)
+
+var ErrQueueFull = errors.New("Too many repositories in the queue, please try again later")
+
+// QueueInfo describes where a task is in the queue
+type QueueInfo struct {
+	Position int           // 1-based position among queued tasks, 0 if the task is not queued
+	Ahead    int           // number of queued tasks ahead
+	Wait     time.Duration // estimated time until the task is done
+}
+
+// duration of a processed repository of the given size in bytes
+type durationSample struct {
+	size     int64
+	duration time.Duration
+}
+
+// key of the requests that produce the same result
+func (this *RepoTask) coalesceKey() string {
+	opts, _ := json.Marshal(this.Opts)
+	languages, _ := json.Marshal(this.Languages)
+	data := append(opts, languages...)
+
+	// private results are shared only by requests with the same token
+	if this.Private {
+		data = append(data, this.token...)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return fmt.Sprintf("%s@%s:%s:%x", strings.ToLower(this.GetURL()), this.Ref.Reference, this.Ref.Commit, hash)
+}
+
+// ExpectedSize is the size in bytes the repository is planned for, the first reservation
+// if the host does not tell it. Clones taking more than planned are aborted mid-transfer
+func (this *TaskQueue) ExpectedSize(size int64) int64 {
+	if size == 0 {
+		return min(UNKNOWN_SIZE_RESERVATION, this.MaxRepoSize)
+	}
+
+	return size
+}
+
+// Add queues the task and returns the id to poll it with, ErrQueueFull is returned
+// if there are too many queued tasks.
+//
+// If the same repository with the same options is already queued or running,
+// the task is not queued, the returned id refers to the existing task instead,
+// and the existing task is moved to the lane of the request if it is higher
+func (this *TaskQueue) Add(task *RepoTask) (string, error) {
+	id := uuid.New().String()
+	key := task.coalesceKey()
+
+	this.mu.Lock()
+
+	if shared, ok := this.inflight[key]; ok {
+		shared.subscribe(id)
+		shared.raise(task.Priority)
+		this.mu.Unlock()
+
+		this.Cache.Set(id, shared, ttlcache.DefaultTTL)
+		this.save(shared)
+
+		return id, nil
+	}
+
+	if len(this.pending) >= MAX_QUEUED_TASKS {
+		this.mu.Unlock()
+		return "", ErrQueueFull
+	}
+
+	if task.Client != "" && this.queuedByClient(task.Client) >= MAX_CLIENT_QUEUED_TASKS {
+		this.mu.Unlock()
+		return "", ErrClientQueueFull
+	}
+
+	// the task is not shared yet, so no lock is needed
+	task.ID = id
+	task.CreatedAt = time.Now()
+	task.subscribers = []string{id}
+	task.setState(STATE_QUEUED)
+	task.key = key
+	this.Cache.Set(task.ID, task, ttlcache.DefaultTTL)
+	this.enqueueLocked(task)
+	this.mu.Unlock()
+
+	this.save(task)
+
+	return task.ID, nil
+}
+
+// put the task at the end of the queue without checking the limit
+func (this *TaskQueue) enqueue(task *RepoTask) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if task.key == "" {
+		task.key = task.coalesceKey()
+	}
+
+	this.enqueueLocked(task)
+}
+
+func (this *TaskQueue) enqueueLocked(task *RepoTask) {
+	task.ctx, task.cancel = context.WithCancelCause(context.Background())
+	task.polledAt = time.Now()
+	task.queuedAt = time.Now()
+	this.pending = append(this.pending, task)
+	this.inflight[task.key] = task
+	this.queued.Signal()
+}
+
+// identical requests are not coalesced with the task anymore,
+// must be called with the mutex held
+func (this *TaskQueue) forget(task *RepoTask) {
+	if this.inflight[task.key] == task {
+		delete(this.inflight, task.key)
+	}
+}
+
+// wait for the next queued task and mark it as running
+func (this *TaskQueue) next() *RepoTask {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for len(this.pending) == 0 {
+		this.queued.Wait()
+	}
+
+	i := this.pick(this.pending, this.runningByClient(), time.Now())
+	task := this.pending[i]
+	this.pending = slices.Delete(this.pending, i, i+1)
+	this.running[task] = time.Now()
+
+	return task
+}
+
+// remove the task from running ones, successful tasks are used for estimates
+func (this *TaskQueue) finish(task *RepoTask) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	start, ok := this.running[task]
+	delete(this.running, task)
+	this.forget(task)
+	task.cancel(nil) // release the context resources
+
+	// the duration of a repository of unknown size tells nothing of the speed
+	if !ok || task.State() != STATE_SUCCEEDED || task.Size == 0 {
+		return
+	}
+
+	this.samples = append(this.samples, durationSample{size: task.Size, duration: time.Since(start)})
+
+	if len(this.samples) > DURATION_SAMPLES {
+		this.samples = this.samples[len(this.samples)-DURATION_SAMPLES:]
+	}
+}
+
+// estimate processing time of a repository of the given size in bytes
+// using the average speed of recent tasks, must be called with the mutex held
+func (this *TaskQueue) estimate(size int64) time.Duration {
+	if len(this.samples) == 0 {
+		return DEFAULT_TASK_DURATION
+	}
+
+	var (
+		totalSize     int64
+		totalDuration time.Duration
+	)
+
+	for _, sample := range this.samples {
+		totalSize += sample.size
+		totalDuration += sample.duration
+	}
+
+	if totalSize == 0 || size == 0 {
+		return totalDuration / time.Duration(len(this.samples))
+	}
+
+	return time.Duration(float64(totalDuration) * float64(size) / float64(totalSize))
+}
+
+// estimate when every worker is free after the running tasks and the given queued ones,
+// must be called with the mutex held
+func (this *TaskQueue) schedule(queued []*RepoTask) []time.Duration {
+	free := make([]time.Duration, 0, this.workers)
+
+	for task, start := range this.running {
+		free = append(free, max(this.estimate(task.Size)-time.Since(start), 0))
+	}
+
+	for len(free) < this.workers {
+		free = append(free, 0)
+	}
+
+	// every queued task is taken by the worker that is free first
+	for _, task := range queued {
+		i := slices.Index(free, slices.Min(free))
+		free[i] += this.estimate(task.Size)
+	}
+
+	return free
+}
+
+// Info returns position of the task in the queue and its estimated wait
+func (this *TaskQueue) Info(task *RepoTask) QueueInfo {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if start, ok := this.running[task]; ok {
+		return QueueInfo{Wait: max(this.estimate(task.Size)-time.Since(start), 0)}
+	}
+
+	ordered := this.order()
+	index := slices.Index(ordered, task)
+
+	if index == -1 {
+		return QueueInfo{}
+	}
+
+	free := this.schedule(ordered[:index])
+
+	return QueueInfo{
+		Position: index + 1,
+		Ahead:    index,
+		Wait:     slices.Min(free) + this.estimate(task.Size),
+	}
+}
+
+// Poll marks the task as still awaited by the client
+func (this *TaskQueue) Poll(task *RepoTask) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	task.polledAt = time.Now()
+}
+
+// Cancel stops polling the task by id. The task is removed from the queue
+// or aborted if it is running, unless other identical requests still wait for it.
+// false is returned if the task is already finished, it is left as it is
+func (this *TaskQueue) Cancel(id string) bool {
+	task, ok := this.GetTask(id)
+
+	if !ok {
+		return false
+	}
+
+	left, unfinished := task.leave(id)
+
+	if !unfinished {
+		return false
+	}
+
+	if left > 0 {
+		this.Cache.Delete(id)
+		this.save(task)
+		return true
+	}
+
+	return this.cancel(task, ErrTaskCanceled)
+}
+
+// remove the task from the queue or abort it if it is running, cause is
+// ErrTaskCanceled or ErrTaskExpired. false is returned if the task is already finished
+func (this *TaskQueue) cancel(task *RepoTask, cause error) bool {
+	this.mu.Lock()
+
+	if i := slices.Index(this.pending, task); i != -1 {
+		this.pending = slices.Delete(this.pending, i, i+1)
+		this.forget(task)
+		this.mu.Unlock()
+
+		state := STATE_CANCELED
+
+		if cause == ErrTaskExpired {
+			state = STATE_EXPIRED
+		}
+
+		task.cancel(cause)
+
+		return task.fail(state, cause) == nil
+	}
+
+	_, running := this.running[task]
+
+	if running {
+		// the worker finishes the task as canceled
+		task.cancel(cause)
+		this.forget(task)
+		// wake up the task if it waits for disk space
+		this.released.Broadcast()
+	}
+
+	this.mu.Unlock()
+
+	return running
+}
+
+// cancel queued and running tasks whose status was not polled for the timeout
+func (this *TaskQueue) cancelAbandoned(timeout time.Duration) {
+	this.mu.Lock()
+	abandoned := make([]*RepoTask, 0)
+
+	for _, task := range this.pending {
+		if time.Since(task.polledAt) > timeout {
+			abandoned = append(abandoned, task)
+		}
+	}
+
+	for task := range this.running {
+		if time.Since(task.polledAt) > timeout {
+			abandoned = append(abandoned, task)
+		}
+	}
+
+	this.mu.Unlock()
+
+	for _, task := range abandoned {
+		if this.cancel(task, ErrTaskExpired) {
+			log.Printf("Task %s expired, status was not polled for %s", task.ID, timeout)
+		}
+	}
+}
+
+// RetryAfter estimates when the first queued task is taken by a worker
+func (this *TaskQueue) RetryAfter() time.Duration {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	free := this.schedule(nil)
+
+	return max(slices.Min(free), time.Second)
+}
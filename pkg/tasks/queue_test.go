@@ -0,0 +1,244 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"git-analyzer/pkg/analyzer"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		samples  []durationSample
+		size     int64
+		expected time.Duration
+	}{
+		{nil, 10 << 20, DEFAULT_TASK_DURATION},
+		{[]durationSample{{10 << 20, 10 * time.Second}}, 10 << 20, 10 * time.Second},
+		{[]durationSample{{10 << 20, 10 * time.Second}}, 30 << 20, 30 * time.Second},
+		// the average speed of all samples is used
+		{[]durationSample{{10 << 20, 10 * time.Second}, {30 << 20, 10 * time.Second}}, 20 << 20, 10 * time.Second},
+		// the size is unknown, the average duration is used
+		{[]durationSample{{10 << 20, 10 * time.Second}, {30 << 20, 20 * time.Second}}, 0, 15 * time.Second},
+	}
+
+	for _, test := range tests {
+		q := newTestQueue()
+		q.samples = test.samples
+
+		if estimate := q.estimate(test.size); estimate != test.expected {
+			t.Errorf("Estimate %d bytes with %v: expected %s, got %s", test.size, test.samples, test.expected, estimate)
+		}
+	}
+}
+
+func TestQueueInfo(t *testing.T) {
+	tests := []struct {
+		workers  int
+		samples  []durationSample
+		expected []time.Duration // estimated waits of the queued tasks in their order
+	}{
+		{1, nil, []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second}},
+		{2, nil, []time.Duration{10 * time.Second, 10 * time.Second, 20 * time.Second}},
+		{3, nil, []time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second}},
+		{1, []durationSample{{10 << 20, 2 * time.Second}}, []time.Duration{2 * time.Second, 4 * time.Second, 6 * time.Second}},
+	}
+
+	for _, test := range tests {
+		q := newTestQueue()
+		q.workers = test.workers
+		q.samples = test.samples
+
+		queued := make([]*RepoTask, 0, len(test.expected))
+
+		for i := range test.expected {
+			task, err := addTestTask(q, fmt.Sprintf("client%d", i), PRIORITY_NORMAL)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			task.Size = 10 << 20
+			queued = append(queued, task)
+		}
+
+		for i, task := range queued {
+			info := q.Info(task)
+
+			if info.Position != i+1 || info.Ahead != i || info.Wait != test.expected[i] {
+				t.Errorf("%d workers, task %d: expected position %d, %d ahead, wait %s, got %+v",
+					test.workers, i, i+1, i, test.expected[i], info)
+			}
+		}
+
+		// the running task is not in the queue anymore, it is done within its estimate
+		running := q.next()
+
+		if info := q.Info(running); info.Position != 0 || info.Ahead != 0 || info.Wait > q.estimate(running.Size) {
+			t.Errorf("%d workers: unexpected running task info %+v", test.workers, info)
+		}
+
+		if info := q.Info(queued[1]); info.Position != 1 {
+			t.Errorf("%d workers: expected the next task to move up, got %+v", test.workers, info)
+		}
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := newTestQueue()
+
+	for i := range MAX_QUEUED_TASKS {
+		if _, err := addTestTask(q, fmt.Sprintf("client%d", i), PRIORITY_NORMAL); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	// the full queue rejects the request instead of blocking it
+	done := make(chan error)
+
+	go func() {
+		_, err := addTestTask(q, "other", PRIORITY_HIGH)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Expected ErrQueueFull, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Adding to the full queue blocked")
+	}
+
+	if retryAfter := q.RetryAfter(); retryAfter < time.Second {
+		t.Errorf("Expected to retry after at least a second, got %s", retryAfter)
+	}
+
+	// identical requests do not take a place in the queue
+	task := q.next()
+
+	if _, err := q.Add(&RepoTask{Owner: task.Owner, Name: task.Name, Client: "other", Opts: &analyzer.Options{}}); err != nil {
+		t.Errorf("Expected the running repository to be shared, got %v", err)
+	}
+
+	if _, err := addTestTask(q, "other", PRIORITY_NORMAL); err != nil {
+		t.Errorf("Expected the queue to accept a task once one is taken, got %v", err)
+	}
+
+	if _, err := addTestTask(q, "another", PRIORITY_NORMAL); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	newTask := func() *RepoTask {
+		return &RepoTask{
+			Owner:    "owner",
+			Name:     "name",
+			Ref:      Ref{Name: "main", Reference: "refs/heads/main", Commit: "0123456789abcdef0123456789abcdef01234567"},
+			Priority: PRIORITY_LOW,
+			Opts:     &analyzer.Options{},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(task *RepoTask)
+		shared bool
+	}{
+		{"identical", func(task *RepoTask) {}, true},
+		{"other case", func(task *RepoTask) { task.Owner = "Owner" }, true},
+		{"other client", func(task *RepoTask) { task.Client = "other" }, true},
+		{"other repository", func(task *RepoTask) { task.Name = "other" }, false},
+		{"other commit", func(task *RepoTask) { task.Ref.Commit = "89abcdef0123456789abcdef0123456789abcdef" }, false},
+		{"other options", func(task *RepoTask) { task.Opts.DetectDuplicates = true }, false},
+		{"other languages", func(task *RepoTask) { task.Languages = []analyzer.LanguageData{{Name: "Custom"}} }, false},
+	}
+
+	for _, test := range tests {
+		q := newTestQueue()
+		firstID, _ := q.Add(newTask())
+		first, _ := q.GetTask(firstID)
+
+		request := newTask()
+		request.Priority = PRIORITY_HIGH
+		test.modify(request)
+
+		id, err := q.Add(request)
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+
+		task, _ := q.GetTask(id)
+
+		if shared := task == first; shared != test.shared {
+			t.Errorf("%s: expected shared %v, got %v", test.name, test.shared, shared)
+			continue
+		}
+
+		// every request polls the task by its own id
+		if id == firstID {
+			t.Errorf("%s: expected a new id for the request", test.name)
+		}
+
+		if !test.shared {
+			continue
+		}
+
+		snapshot := first.Snapshot()
+
+		if len(snapshot.Subscribers) != 2 || snapshot.Subscribers[1] != id {
+			t.Errorf("%s: expected both requests to subscribe, got %v", test.name, snapshot.Subscribers)
+		}
+
+		if len(q.pending) != 1 || snapshot.Priority != PRIORITY_HIGH {
+			t.Errorf("%s: expected a single task raised to the request priority, got %d %s", test.name, len(q.pending), snapshot.Priority)
+		}
+	}
+}
+
+func TestCoalescingEndsWithTask(t *testing.T) {
+	q := newTestQueue()
+	firstID, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+
+	// the running task is still shared, it gives the same result to both requests
+	running := q.next()
+	id, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+
+	if task, _ := q.GetTask(id); task != running {
+		t.Fatalf("Expected the running task to be shared")
+	}
+
+	running.transition(STATE_FETCHING, nil)
+	running.transition(STATE_ANALYZING, nil)
+	running.transition(STATE_SUCCEEDED, func() { running.result = &analyzer.Result{TotalFiles: 1} })
+	q.finish(running)
+
+	for _, id := range []string{firstID, id} {
+		if snapshot, ok := q.GetSnapshot(id); !ok || snapshot.Result == nil || snapshot.Result.TotalFiles != 1 {
+			t.Errorf("Expected the result by %s, got %v %+v", id, ok, snapshot.Result)
+		}
+	}
+
+	// the finished task is not canceled, the result stays for both requests
+	if q.Cancel(firstID) || len(running.Snapshot().Subscribers) != 2 {
+		t.Errorf("Expected the finished task to be left as it is, got %v", running.Snapshot().Subscribers)
+	}
+
+	// the request stops polling, the task is kept for the other one
+	q.DeleteTask(firstID)
+
+	if _, ok := q.GetSnapshot(id); !ok || len(running.Snapshot().Subscribers) != 1 {
+		t.Errorf("Expected the task to be kept for the other request, got %v", running.Snapshot().Subscribers)
+	}
+
+	// the finished task is not shared with new requests
+	id, _ = q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+
+	if task, _ := q.GetTask(id); task == running || len(q.pending) != 1 {
+		t.Errorf("Expected a new task after the shared one finished")
+	}
+}
@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Ref is the revision of the repository to analyze, it is resolved before the task is queued
+type Ref struct {
+	Name      string                 `json:"name"`      // branch, tag or commit as requested, the default branch if none was
+	Reference plumbing.ReferenceName `json:"reference"` // full name of the branch or tag, empty for a commit
+	Commit    string                 `json:"commit"`    // SHA of the resolved commit, empty for the default branch of old tasks
+}
+
+// clone only the revision into the empty dir, auth is nil for public repositories
+func (this Ref) clone(ctx context.Context, dir, url string, auth transport.AuthMethod) error {
+	if this.Reference != "" || this.Commit == "" {
+		repo, err := gogit.PlainCloneContext(ctx, dir, false, &gogit.CloneOptions{
+			URL:           url,
+			Auth:          auth,
+			ReferenceName: this.Reference, // HEAD if empty
+			SingleBranch:  true,
+			Depth:         1,
+		})
+
+		if err != nil || this.Commit == "" {
+			return err
+		}
+
+		head, err := repo.Head()
+
+		if err != nil {
+			return err
+		}
+
+		if head.Hash().String() == this.Commit {
+			return nil
+		}
+
+		// the branch moved since it was resolved, the resolved commit is analyzed,
+		// results are cached by it
+		remote, err := repo.Remote(gogit.DefaultRemoteName)
+
+		if err != nil {
+			return err
+		}
+
+		return this.checkoutCommit(ctx, repo, remote, auth)
+	}
+
+	// a commit has no name to clone by, it is fetched by SHA and checked out
+	repo, err := gogit.PlainInit(dir, false)
+
+	if err != nil {
+		return err
+	}
+
+	remote, err := repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return this.checkoutCommit(ctx, repo, remote, auth)
+}
+
+// fetch the commit by SHA from the remote and check it out
+func (this Ref) checkoutCommit(ctx context.Context, repo *gogit.Repository, remote *gogit.Remote, auth transport.AuthMethod) error {
+	refSpec := this.Commit + ":" + plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, this.Commit).String()
+	err := remote.FetchContext(ctx, &gogit.FetchOptions{
+		RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Auth:     auth,
+		Depth:    1,
+	})
+
+	// servers that do not allow to want any commit send the whole history
+	if errors.Is(err, gogit.ErrExactSHA1NotSupported) {
+		err = remote.FetchContext(ctx, &gogit.FetchOptions{
+			RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf(gitconfig.DefaultFetchRefSpec, gogit.DefaultRemoteName))},
+			Auth:     auth,
+			Tags:     gogit.AllTags,
+		})
+	}
+
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		return err
+	}
+
+	return worktree.Checkout(&gogit.CheckoutOptions{Hash: plumbing.NewHash(this.Commit)})
+}
@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commit a file with the content into the repository
+func commitFile(t *testing.T, repo *gogit.Repository, dir, content string) plumbing.Hash {
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := worktree.Add("file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := worktree.Commit(content, &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestRefClone(t *testing.T) {
+	origin := t.TempDir()
+	repo, err := gogit.PlainInit(origin, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := commitFile(t, repo, origin, "first")
+
+	if _, err := repo.CreateTag("v1", first, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	second := commitFile(t, repo, origin, "second")
+	head, _ := repo.Head()
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/old", first)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref      Ref
+		expected string
+	}{
+		{Ref{}, "second"},
+		{Ref{Name: head.Name().Short(), Reference: head.Name(), Commit: second.String()}, "second"},
+		{Ref{Name: "old", Reference: "refs/heads/old", Commit: first.String()}, "first"},
+		{Ref{Name: "v1", Reference: "refs/tags/v1", Commit: first.String()}, "first"},
+		{Ref{Name: first.String(), Commit: first.String()}, "first"},
+		// the branch moved to the second commit after it was resolved
+		{Ref{Name: head.Name().Short(), Reference: head.Name(), Commit: first.String()}, "first"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+
+		if err := test.ref.clone(context.Background(), dir, origin, nil); err != nil {
+			t.Errorf("Clone %+v: %v", test.ref, err)
+			continue
+		}
+
+		if content, _ := os.ReadFile(filepath.Join(dir, "file.txt")); string(content) != test.expected {
+			t.Errorf("Clone %+v: expected %q, got %q", test.ref, test.expected, content)
+		}
+	}
+}
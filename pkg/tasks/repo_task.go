@@ -1,31 +1,36 @@
 package tasks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"git-analyzer/pkg/analyzer"
 	"git-analyzer/pkg/config"
+	"git-analyzer/pkg/netguard"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	gogit "github.com/go-git/go-git/v5"
-	"github.com/google/uuid"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/jellydator/ttlcache/v3"
 )
 
 const (
 	REQUIRED_LIMIT    int64  = 104857600 // Minimum required free space: 100 MB in bytes
 	TEMP_FILE_PATTERN string = "git"     // repository dir name pattern for better repository identification
+)
 
-	// Repository task statuses
-	STATUS_INIT    uint8 = 1
-	STATUS_FETCH   uint8 = 2
-	STATUS_ANALYZE uint8 = 3
-	STATUS_DONE    uint8 = 4
+var (
+	ErrTaskCanceled = errors.New("Task canceled")
+	errTokenLost    = errors.New("Access tokens are not kept across restarts, please submit the private repository again")
+	ErrTaskExpired  = errors.New("Task canceled, its status was not polled for too long")
+	errMemoryLimit  = errors.New("Memory limit exceeded")
 )
 
 var RepoTaskQueue *TaskQueue
@@ -36,115 +41,417 @@ var RepoTaskQueue *TaskQueue
 //
 // The server can receive many requests in asynchronous mode,
 // but the server will not always be able to analyze the repository due to lack of disk space.
-// Each async request will be queued and processed by a single goroutine
+// Each async request will be queued and processed by one of the worker goroutines,
+// a worker reserves disk space for the repository before cloning it
 type TaskQueue struct {
-	maxDiskSize    int64          // max available space on disk in bytes
-	MaxRepoSize    int64          // max repository size in bytes
-	freeMemory     int64          // free memory in bytes
-	TaskChan       chan *RepoTask // channel of repository tasks
-	Cache          *ttlcache.Cache[string, *RepoTask]
-	useFileWorkers bool
+	mu              sync.Mutex
+	released        *sync.Cond              // signaled when a reservation is released
+	queued          *sync.Cond              // signaled when a task is queued
+	pending         []*RepoTask             // queued tasks in processing order
+	inflight        map[string]*RepoTask    // queued and running tasks by coalesce key
+	running         map[*RepoTask]time.Time // tasks taken by workers and their start time
+	samples         []durationSample        // recent durations of processed tasks
+	maxDiskSize     int64                   // max available space on disk in bytes
+	MaxRepoSize     int64                   // max repository size in bytes
+	freeMemory      int64                   // free memory in bytes, reservations are already subtracted
+	reserved        int64                   // disk space reserved by the repositories being cloned or analyzed
+	workers         int                     // number of worker goroutines
+	fetchTimeout    time.Duration           // deadline of cloning a repository, 0 if there is none
+	analysisTimeout time.Duration           // deadline of analyzing a repository, 0 if there is none
+	Cache           *ttlcache.Cache[string, *RepoTask]
+	useFileWorkers  bool
 
 	// all calculations with free memory are not carried out directly with the disk,
 	// but only superficially, so it is important to at least sometimes
 	// synchronize real data on the filled memory.
 	// synchronize every N-th usage
 	syncEvery    int32
-	writingCount int32  // how many write operations are performed
-	rootDir      string // root directory of repositories
+	writingCount int32     // how many write operations are performed
+	rootDir      string    // root directory of repositories
+	store        TaskStore // durable task storage, tasks are kept only in memory if nil
 }
 
+// GetTask returns the live task by its id or the id of an identical request,
+// the task is changed by its worker and must be read with Snapshot
 func (this *TaskQueue) GetTask(id string) (*RepoTask, bool) {
-	task := this.Cache.Get(id)
+	if item := this.Cache.Get(id); item != nil {
+		return item.Value(), true
+	}
+
+	// queued and running tasks stay live even if nobody polled them for long
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, task := range this.inflight {
+		if task.ID == id || slices.Contains(task.Snapshot().Subscribers, id) {
+			this.Cache.Set(id, task, ttlcache.DefaultTTL)
+			return task, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetSnapshot returns the state of the task by its id or the id of an identical request.
+// Finished tasks no longer in memory are read from the store, their snapshots are read-only
+func (this *TaskQueue) GetSnapshot(id string) (TaskSnapshot, bool) {
+	if task, ok := this.GetTask(id); ok {
+		return task.Snapshot(), true
+	}
+
+	stored, ok := this.getStored(id)
+
+	if !ok {
+		return TaskSnapshot{}, false
+	}
+
+	snapshot := stored.Snapshot()
+	snapshot.ReadOnly = true
+
+	return snapshot, true
+}
 
-	if task == nil {
+// finished task of the store by its id or the id of an identical request,
+// the others are live and must not be shadowed by their detached copies
+func (this *TaskQueue) getStored(id string) (*RepoTask, bool) {
+	if this.store == nil {
 		return nil, false
 	}
 
-	val := task.Value()
+	stored, ok := this.store.Get(id)
+
+	// the store knows tasks by their own ids, the ones of identical requests are looked up
+	if !ok {
+		tasks, err := this.store.List()
+
+		if err != nil {
+			log.Printf("Failed to list stored tasks: %v", err)
+			return nil, false
+		}
+
+		for _, task := range tasks {
+			if slices.Contains(task.Snapshot().Subscribers, id) {
+				stored, ok = task, true
+				break
+			}
+		}
+	}
 
-	return val, true
+	if !ok || !stored.State().Finished() {
+		return nil, false
+	}
+
+	return stored, true
 }
 
+// DeleteTask stops polling the task by id,
+// the task is deleted when no other identical requests wait for it
 func (this *TaskQueue) DeleteTask(id string) {
+	task, ok := this.GetTask(id)
 	this.Cache.Delete(id)
+
+	// finished tasks never change, so the stored copy is updated
+	if !ok {
+		task, ok = this.getStored(id)
+	}
+
+	if !ok {
+		return
+	}
+
+	if task.unsubscribe(id) > 0 {
+		this.save(task)
+		return
+	}
+
+	if this.store != nil {
+		if err := this.store.Delete(task.ID); err != nil {
+			log.Printf("Failed to delete task %s: %v", task.ID, err)
+		}
+	}
 }
 
-func (this *TaskQueue) Add(task *RepoTask) string {
-	taskID := uuid.New().String()
-	this.Cache.Set(taskID, task, ttlcache.DefaultTTL)
-	this.TaskChan <- task
-	return taskID
+// persist current state of the task. The store takes the snapshot and writes it
+// with the save lock of the task held, so an older state never overwrites a newer one
+func (this *TaskQueue) save(task *RepoTask) {
+	if this.store == nil {
+		return
+	}
+
+	task.saveMu.Lock()
+	defer task.saveMu.Unlock()
+
+	if err := this.store.Save(task); err != nil {
+		log.Printf("Failed to save task %s: %v", task.ID, err)
+	}
 }
 
-// check if there is enough free space to write a repository of the given size in bytes on the disk.
-func (this *TaskQueue) canWrite(size int64) bool {
+// UseStore makes the queue durable, tasks of the store are restored
+// and the ones that were queued or running before restart are queued again
+func (this *TaskQueue) UseStore(store TaskStore) error {
+	this.store = store
+	stored, err := store.List()
 
-	if config.Vars.Debug {
-		log.Printf("total: %d MB, free: %d MB, repo size: %d MB", this.maxDiskSize/1048576, this.freeMemory/1048576, size/1048576)
+	if err != nil {
+		return err
 	}
 
+	requeue := make([]*RepoTask, 0)
+
+	for _, task := range stored {
+		this.Cache.Set(task.ID, task, ttlcache.DefaultTTL)
+
+		snapshot := task.Snapshot()
+
+		for _, id := range snapshot.Subscribers {
+			this.Cache.Set(id, task, ttlcache.DefaultTTL)
+		}
+
+		if snapshot.Finished() {
+			continue
+		}
+
+		// the token of a private repository is gone with the restart
+		if task.Private {
+			if err := task.fail(STATE_FAILED, newTaskError(ERROR_AUTH, errTokenLost)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if snapshot.State != STATE_QUEUED {
+			if err := task.transition(STATE_QUEUED, nil); err != nil {
+				return err
+			}
+		}
+
+		requeue = append(requeue, task)
+	}
+
+	log.Printf("Restored %d tasks, %d of them are queued again", len(stored), len(requeue))
+
+	// restored tasks are queued even if there are more of them than the limit
+	for _, task := range requeue {
+		this.enqueue(task)
+	}
+
+	return nil
+}
+
+// check if a repository of the given size in bytes can ever be written on the disk
+func (this *TaskQueue) fits(size int64) bool {
 	// Check if repository size exceeds the maximum allowable size
 	if size > this.MaxRepoSize {
 		return false
 	}
 
-	// Check if free memory is less than the required limit
-	if this.freeMemory < REQUIRED_LIMIT {
-		return false
+	// Check if the new directory size exceeds the maximum allowable size minus the required limit
+	return size <= this.maxDiskSize-REQUIRED_LIMIT
+}
+
+// check if there is enough free space to write a repository of the given size in bytes on the disk.
+// must be called with the mutex held
+func (this *TaskQueue) canWrite(size int64) bool {
+
+	if config.Vars.Debug {
+		log.Printf("total: %d MB, free: %d MB, reserved: %d MB, repo size: %d MB",
+			this.maxDiskSize/1048576, this.freeMemory/1048576, this.reserved/1048576, size/1048576)
 	}
 
-	// Check if the new directory size exceeds the maximum allowable size minus the required limit
-	if size > this.maxDiskSize-REQUIRED_LIMIT {
-		return false
+	// Check if free memory after writing is less than the required limit
+	return this.fits(size) && this.freeMemory-size >= REQUIRED_LIMIT
+}
+
+// reserve disk space for a repository of the given size in bytes.
+// if the space is held by other repositories, it waits until they are released
+// or ctx is done, an error is returned if the repository can not be written at all
+func (this *TaskQueue) reserve(ctx context.Context, size int64) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for !this.canWrite(size) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if this.reserved == 0 || !this.fits(size) {
+			return errMemoryLimit
+		}
+
+		this.released.Wait()
 	}
 
-	return true
+	this.freeMemory -= size
+	this.reserved += size
+
+	return nil
 }
 
-// try to clone a repository in the root folder and return the path of the repository
-func (this *TaskQueue) writeRepo(task *RepoTask) (path string, fetchSpeed time.Duration, err error) {
-	if !this.canWrite(task.Size) {
-		return "", 0, errors.New("Memory limit exceeded")
+// grow the reservation of a repository of unknown size for the used bytes without waiting.
+// It is at least doubled within the repository size limit as long as the disk has free space,
+// the reservation of the task is returned
+func (this *TaskQueue) grow(task *RepoTask, used int64) int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	reserved := task.reserved.Load()
+	size := min(max(2*reserved, used), this.MaxRepoSize)
+
+	if size <= reserved || this.freeMemory-(size-reserved) < REQUIRED_LIMIT {
+		return reserved
 	}
 
-	dir, _ := os.MkdirTemp("", TEMP_FILE_PATTERN)
-	fetchRepoStart := time.Now()
+	this.freeMemory -= size - reserved
+	this.reserved += size - reserved
+	task.reserved.Store(size)
 
-	// clone the repository
-	// works only for public repositories
-	_, err = gogit.PlainClone(dir, false, &gogit.CloneOptions{
-		Depth: 1,
-		URL:   task.GetURL(),
-	})
+	return size
+}
 
-	fetchRepoEnd := time.Since(fetchRepoStart)
+// give back disk space reserved for a repository that has been removed
+func (this *TaskQueue) release(size int64) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.freeMemory += size
+	this.reserved -= size
+
+	// the walk never counts more than the limit, but keep the invariant anyway
+	if this.freeMemory > this.maxDiskSize-this.reserved {
+		this.freeMemory = this.maxDiskSize - this.reserved
+	}
+
+	this.released.Broadcast()
+}
+
+// try to clone a repository in the root folder and return the path of the repository,
+// disk space for the repository must be reserved
+func (this *TaskQueue) writeRepo(task *RepoTask) (path string, fetchSpeed time.Duration, err error) {
+	dir, err := os.MkdirTemp("", TEMP_FILE_PATTERN)
 
 	if err != nil {
 		return "", 0, err
 	}
 
+	ctx, cancel := WithPhaseTimeout(task.ctx, PHASE_FETCH, this.fetchTimeout)
+	defer cancel()
+
+	if task.PublicOnly {
+		ctx = netguard.PublicOnly(ctx)
+	}
+
+	fetchRepoStart := time.Now()
+	delay := CLONE_RETRY_DELAY
+
+	for attempt := 0; ; attempt++ {
+		// clone the repository
+		// works only for public repositories
+		var auth transport.AuthMethod
+
+		if task.token != "" {
+			auth = &githttp.BasicAuth{Username: task.tokenUser, Password: task.token}
+		}
+
+		var grow func(used int64) int64
+
+		// the host does not tell the size, the reservation grows with the clone
+		if task.Size == 0 {
+			grow = func(used int64) int64 { return this.grow(task, used) }
+		}
+
+		cloneCtx, budget, stop := watchSize(ctx, dir, task.reserved.Load(), grow)
+		err = ScrubSecret(task.Ref.clone(cloneCtx, dir, task.GetURL(), auth), task.token)
+
+		// the last check catches clones too fast for the periodic ones
+		if err == nil {
+			err = budget.check(dirSize(dir))
+		}
+
+		stop()
+
+		if errBudget := budget.err(cloneCtx); errBudget != nil {
+			return dir, 0, newTaskError(ERROR_TOO_LARGE, errBudget)
+		}
+
+		if err == nil {
+			break
+		}
+
+		if errTimeout := PhaseTimeoutOf(ctx); errTimeout != nil {
+			return dir, 0, errTimeout
+		}
+
+		code, transient := classifyCloneError(err)
+
+		if !transient || attempt == CLONE_RETRIES {
+			return dir, 0, newTaskError(code, err)
+		}
+
+		log.Printf("Failed to clone %s, retry in %s: %v", task.GetURL(), delay, err)
+
+		// failed clone leaves a partial repository behind
+		if err := os.RemoveAll(dir); err != nil {
+			return dir, 0, err
+		}
+
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return "", 0, err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			if errTimeout := PhaseTimeoutOf(ctx); errTimeout != nil {
+				return dir, 0, errTimeout
+			}
+
+			return dir, 0, ctx.Err()
+		}
+	}
+
+	fetchRepoEnd := time.Since(fetchRepoStart)
+
 	if config.Vars.Debug {
 		log.Printf("Repo cloned in %d ms\n", fetchRepoEnd.Milliseconds())
 	}
 
-	this.freeMemory -= task.Size
+	this.mu.Lock()
 	this.writingCount++
-	this.syncMemory()
+	shouldSync := this.writingCount >= this.syncEvery
+	this.mu.Unlock()
+
+	if shouldSync {
+		this.syncMemory()
+	}
 
 	return dir, fetchRepoEnd, nil
 }
 
 // sync real memory usage of the disk
 func (this *TaskQueue) syncMemory() {
-	if this.writingCount < this.syncEvery {
-		return
-	}
+	usedSpace := this.usedSpace()
 
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.writingCount = 0 // reset usage count
+
+	// repositories being cloned are counted twice, by the walk and by their reservations,
+	// so the free space is underestimated until the next sync rather than oversubscribed
+	this.freeMemory = this.maxDiskSize - usedSpace - this.reserved
+}
+
+// walk through the root dir and count the size of all patterned files
+func (this *TaskQueue) usedSpace() int64 {
 	var usedSpace int64
 
-	// walk through the root dir and count the size of all patterned files
 	filepath.WalkDir(this.rootDir, func(path string, e os.DirEntry, err error) error {
+		// files can be removed by other workers during the walk
+		if err != nil {
+			return nil
+		}
 
 		if e.IsDir() {
 			// if the directory is located at the 1st level of nesting,
@@ -155,69 +462,170 @@ func (this *TaskQueue) syncMemory() {
 			return nil
 		}
 
-		fileInfo, _ := e.Info()
-		usedSpace += fileInfo.Size()
+		if fileInfo, err := e.Info(); err == nil {
+			usedSpace += fileInfo.Size()
+		}
 
 		return nil
 	})
 
-	this.writingCount = 0 // reset usage count
-	this.freeMemory = this.maxDiskSize - usedSpace
+	return usedSpace
 }
 
+// RepoTask is a repository analysis request.
+// Exported fields are set before the task is queued and never change,
+// the state and the outcome are read with Snapshot
 type RepoTask struct {
-	Status uint8 // Task status
-	// ID            string            // Task ID
-	Size          int64             // size of repository in bytes
-	Owner         string            // repository owner
-	Name          string            // repository name
-	Opts          *analyzer.Options // validation options
-	Result        *analyzer.Result
-	FetchSpeed    time.Duration
-	AnalysisSpeed time.Duration
-	Err           error
+	ID         string                  // Task ID
+	Size       int64                   // size of repository in bytes, 0 if the host does not tell it
+	Owner      string                  // repository owner
+	Name       string                  // repository name
+	URL        string                  // HTTPS clone URL, the github.com one of Owner and Name if empty
+	Ref        Ref                     // revision to analyze
+	Private    bool                    // the repository is private, its result is never shared with other requests
+	PublicOnly bool                    // the host was given by the user, it is reached only at public addresses
+	Opts       *analyzer.Options       // validation options
+	Languages  []analyzer.LanguageData // custom languages of the request, Opts.Registry is built from them
+	CreatedAt  time.Time
+	Client     string   // client that created the task, the IP address or the API key name
+	Priority   Priority // scheduling lane, changed with both the queue and the task locks held
+
+	mu            sync.RWMutex
+	state         TaskState
+	result        *analyzer.Result
+	err           error
+	fetchSpeed    time.Duration
+	analysisSpeed time.Duration
+	updatedAt     time.Time
+	history       []StateChange
+	reserved      atomic.Int64 // disk space reserved for the clone in bytes, grown for repositories of unknown size
+	subscribers   []string     // ids of the identical requests sharing the task, including ID
+
+	saveMu sync.Mutex // held while the task is saved, so saves of the task are written in order
+
+	// access token of a private repository, it is never persisted and is dropped once the repository is cloned.
+	// read only by the worker running the task
+	token     string
+	tokenUser string // user name the host expects with the token
+
+	// guarded by the queue mutex
+	key      string                  // coalesce key of identical requests
+	ctx      context.Context         // canceled to abort the clone and the analysis
+	cancel   context.CancelCauseFunc // the cause is the error of the canceled task
+	polledAt time.Time               // last time the client asked for the status
+	queuedAt time.Time               // last time the task was queued
+}
+
+// UseToken sets the access token to clone a private repository with and the user name
+// the host expects with it, must be called before the task is added
+func (this *RepoTask) UseToken(user, token string) {
+	this.tokenUser = user
+	this.token = token
 }
 
 func (this *RepoTask) GetURL() string {
-	return fmt.Sprintf("https://github.com/%s/%s", this.Owner, this.Name)
+	return repoURL(this.URL, this.Owner, this.Name)
 }
 
-func (this *RepoTask) UpdateStatus(status uint8) {
-	this.Status = status
+// tasks created before other hosts were supported have no URL, they are of github.com
+func repoURL(url, owner, name string) string {
+	if url != "" {
+		return url
+	}
+
+	return fmt.Sprintf("https://github.com/%s/%s", owner, name)
+}
+
+// disk space first reserved for the clone in bytes, the clone is aborted if it takes more.
+// The reported size is the packed history and the checkout takes about as much again,
+// so twice the size is reserved as long as it is within the repository size limit.
+// Git tells nothing of the size before the pack is sent, so a repository of unknown size
+// starts with a small reservation that grows while it is cloned
+func (this *RepoTask) reservation() int64 {
+	if this.Size == 0 {
+		return min(UNKNOWN_SIZE_RESERVATION, RepoTaskQueue.MaxRepoSize)
+	}
+
+	return min(2*this.Size, max(this.Size, RepoTaskQueue.MaxRepoSize))
 }
 
+// Process runs the task and moves it to a final state,
+// a task interrupted by cancellation is canceled or expired whatever error it has
 func (this *RepoTask) Process() {
-	defer this.UpdateStatus(STATUS_DONE)
+	result, analysisSpeed, err := this.run()
 
-	this.UpdateStatus(STATUS_FETCH)
+	if this.ctx.Err() != nil {
+		state := STATE_CANCELED
+		cause := context.Cause(this.ctx)
 
-	if !RepoTaskQueue.canWrite(this.Size) {
-		this.Result = nil
-		this.Err = fmt.Errorf("Memory limit exceeded")
-		this.UpdateStatus(STATUS_DONE)
-		return
+		if errors.Is(cause, ErrTaskExpired) {
+			state = STATE_EXPIRED
+		}
+
+		err = this.fail(state, cause)
+	} else if err != nil {
+		err = this.fail(STATE_FAILED, err)
+	} else {
+		err = this.transition(STATE_SUCCEEDED, func() {
+			this.result = result
+			this.analysisSpeed = analysisSpeed
+		})
+	}
+
+	if err != nil {
+		log.Printf("Failed to finish task %s: %v", this.ID, err)
+	}
+}
+
+// clone and analyze the repository
+func (this *RepoTask) run() (*analyzer.Result, time.Duration, error) {
+	reservation := this.reservation()
+
+	if err := RepoTaskQueue.reserve(this.ctx, reservation); err != nil {
+		return nil, 0, err
+	}
+
+	this.reserved.Store(reservation)
+
+	// deferred calls run in reverse order, the space is released after the repository is removed
+	defer func() { RepoTaskQueue.release(this.reserved.Load()) }()
+
+	if err := this.transition(STATE_FETCHING, nil); err != nil {
+		return nil, 0, err
 	}
 
 	dir, fetchSpeed, err := RepoTaskQueue.writeRepo(this)
+	this.token = ""
 
-	defer os.RemoveAll(dir)
+	if dir != "" {
+		defer os.RemoveAll(dir)
+	}
 
 	if err != nil {
-		this.Err = err
-		this.Result = nil
-		this.UpdateStatus(STATUS_DONE)
-		return
+		return nil, 0, err
 	}
 
-	this.UpdateStatus(STATUS_ANALYZE)
+	err = this.transition(STATE_ANALYZING, func() {
+		this.fetchSpeed = fetchSpeed
+	})
 
-	repoAnalyzer := analyzer.New(this.Opts)
-	result, analysisSpeed, err := repoAnalyzer.Do(dir, config.Vars.UseFileWorkers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the analyzer extends the options, the task ones are read by the store concurrently
+	opts := *this.Opts
+
+	ctx, cancel := WithPhaseTimeout(this.ctx, PHASE_ANALYSIS, RepoTaskQueue.analysisTimeout)
+	defer cancel()
+
+	result, analysisSpeed, err := analyzer.New(&opts).DoContext(ctx, dir, config.Vars.UseFileWorkers)
+
+	if errTimeout := PhaseTimeoutOf(ctx); errTimeout != nil {
+		return nil, 0, errTimeout
+	}
 
-	this.FetchSpeed = fetchSpeed
-	this.AnalysisSpeed = analysisSpeed
-	this.Result = result
-	this.Err = err
+	return result, analysisSpeed, err
 }
 
 func InitMe() {
@@ -231,31 +639,50 @@ func InitMe() {
 		syncEvery          = config.Vars.SyncEvery
 		maxDiskSizeInBytes = config.Vars.DiskSize * 1024 * 1024
 		maxRepoSize        = config.Vars.MaxRepoSize * 1024 * 1024
+		workers            = max(config.Vars.TaskWorkers, 1)
+		pollTimeout        = time.Duration(config.Vars.TaskPollTimeout) * time.Second
+		fetchTimeout       = time.Duration(config.Vars.FetchTimeout) * time.Second
+		analysisTimeout    = time.Duration(config.Vars.AnalysisTimeout) * time.Second
 	)
 
 	q := &TaskQueue{
-		TaskChan:       make(chan *RepoTask, 20),
-		useFileWorkers: config.Vars.UseFileWorkers,
-		maxDiskSize:    maxDiskSizeInBytes,
-		freeMemory:     maxDiskSizeInBytes,
-		MaxRepoSize:    maxRepoSize,
-		Cache:          cache,
-		rootDir:        os.TempDir(),
-		syncEvery:      syncEvery,
-		writingCount:   syncEvery + 1,
+		running:         make(map[*RepoTask]time.Time),
+		inflight:        make(map[string]*RepoTask),
+		useFileWorkers:  config.Vars.UseFileWorkers,
+		maxDiskSize:     maxDiskSizeInBytes,
+		freeMemory:      maxDiskSizeInBytes,
+		MaxRepoSize:     maxRepoSize,
+		Cache:           cache,
+		rootDir:         os.TempDir(),
+		syncEvery:       syncEvery,
+		workers:         workers,
+		fetchTimeout:    fetchTimeout,
+		analysisTimeout: analysisTimeout,
 	}
 
+	q.released = sync.NewCond(&q.mu)
+	q.queued = sync.NewCond(&q.mu)
 	q.syncMemory() // sync memory for the first time
 
-	// go single goroutine for managing tasks
-	go func() {
-		for {
-			select {
-			case task := <-q.TaskChan:
+	// go worker goroutines for managing tasks
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			for {
+				task := q.next()
 				task.Process()
+				q.finish(task)
 			}
-		}
-	}()
+		}()
+	}
+
+	// cancel tasks nobody waits for anymore
+	if pollTimeout > 0 {
+		go func() {
+			for range time.Tick(pollTimeout / 2) {
+				q.cancelAbandoned(pollTimeout)
+			}
+		}()
+	}
 
 	RepoTaskQueue = q
 }
@@ -0,0 +1,188 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		freeMemory int64
+		reserved   int64
+		size       int64
+		expected   error // context.Canceled if the reservation waits for space
+	}{
+		{500 << 20, 0, 200 << 20, nil},
+		{500 << 20, 0, 400 << 20, nil},
+		// another repository holds the space, the reservation waits for it
+		{300 << 20, 200 << 20, 250 << 20, context.Canceled},
+		// nothing is held, the space will never be freed
+		{300 << 20, 0, 250 << 20, errMemoryLimit},
+		// larger than any repository or than the disk
+		{500 << 20, 0, 600 << 20, errMemoryLimit},
+		{500 << 20, 200 << 20, 600 << 20, errMemoryLimit},
+	}
+
+	for _, test := range tests {
+		q := newTestQueue()
+		q.maxDiskSize = 500 << 20
+		q.MaxRepoSize = 450 << 20
+		q.freeMemory = test.freeMemory
+		q.reserved = test.reserved
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+
+		go func() {
+			done <- q.reserve(ctx, test.size)
+		}()
+
+		var err error
+
+		select {
+		case err = <-done:
+		case <-time.After(50 * time.Millisecond):
+			// waiting reservations are woken up by canceled tasks the same way
+			cancel()
+			q.mu.Lock()
+			q.released.Broadcast()
+			q.mu.Unlock()
+			err = <-done
+		}
+
+		cancel()
+
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Reserve %d MB of %d MB free: expected %v, got %v", test.size>>20, test.freeMemory>>20, test.expected, err)
+			continue
+		}
+
+		expectedFree, expectedReserved := test.freeMemory, test.reserved
+
+		if err == nil {
+			expectedFree -= test.size
+			expectedReserved += test.size
+		}
+
+		if q.freeMemory != expectedFree || q.reserved != expectedReserved {
+			t.Errorf("Reserve %d MB of %d MB free: expected %d/%d free/reserved, got %d/%d",
+				test.size>>20, test.freeMemory>>20, expectedFree, expectedReserved, q.freeMemory, q.reserved)
+		}
+	}
+}
+
+func TestReleaseWakesReservation(t *testing.T) {
+	q := newTestQueue()
+	q.maxDiskSize = 500 << 20
+	q.MaxRepoSize = 300 << 20
+	q.freeMemory = 500 << 20
+
+	if err := q.reserve(context.Background(), 300<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		done <- q.reserve(context.Background(), 200<<20)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the reservation to wait for space, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the space of the removed repository is credited back
+	q.release(300 << 20)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Released space was not given to the waiting reservation")
+	}
+
+	q.release(200 << 20)
+
+	if q.freeMemory != q.maxDiskSize || q.reserved != 0 {
+		t.Errorf("Expected all the space to be free, got %d free, %d reserved", q.freeMemory, q.reserved)
+	}
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	q := newTestQueue()
+	q.maxDiskSize = 500 << 20
+	q.MaxRepoSize = 100 << 20
+	q.freeMemory = 500 << 20
+
+	var (
+		wg      sync.WaitGroup
+		writing atomic.Int64
+		peak    atomic.Int64
+	)
+
+	// the disk fits four repositories above the required free space
+	for range 16 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := q.reserve(context.Background(), 100<<20); err != nil {
+				t.Error(err)
+				return
+			}
+
+			now := writing.Add(1)
+
+			for current := peak.Load(); now > current && !peak.CompareAndSwap(current, now); current = peak.Load() {
+			}
+
+			time.Sleep(time.Millisecond)
+			writing.Add(-1)
+			q.release(100 << 20)
+		}()
+	}
+
+	wg.Wait()
+
+	if peak.Load() > 4 {
+		t.Errorf("Expected at most 4 repositories written at once, got %d", peak.Load())
+	}
+
+	if q.freeMemory != q.maxDiskSize || q.reserved != 0 {
+		t.Errorf("Expected all the space to be free, got %d free, %d reserved", q.freeMemory, q.reserved)
+	}
+}
+
+func TestReservation(t *testing.T) {
+	tests := []struct {
+		size        int64
+		maxRepoSize int64
+		expected    int64
+	}{
+		{100 << 20, 500 << 20, 200 << 20},
+		{300 << 20, 500 << 20, 500 << 20},
+		// the reported size is over the limit, it is trusted rather than the limit
+		{600 << 20, 500 << 20, 600 << 20},
+	}
+
+	queue := RepoTaskQueue
+	defer func() { RepoTaskQueue = queue }()
+
+	for _, test := range tests {
+		RepoTaskQueue = newTestQueue()
+		RepoTaskQueue.MaxRepoSize = test.maxRepoSize
+
+		if reservation := (&RepoTask{Size: test.size}).reservation(); reservation != test.expected {
+			t.Errorf("Size %d of %d: expected %d, got %d", test.size, test.maxRepoSize, test.expected, reservation)
+		}
+	}
+}
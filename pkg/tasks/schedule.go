@@ -0,0 +1,194 @@
+package tasks
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Priority is a scheduling lane of the task, lower value is served first
+type Priority uint8
+
+const (
+	PRIORITY_HIGH   Priority = iota // API clients and small repositories
+	PRIORITY_NORMAL                 // regular requests
+	PRIORITY_LOW                    // scheduled refreshes and other background requests
+)
+
+const (
+	SMALL_REPO_SIZE         int64 = 5 * 1024 * 1024 // repositories up to 5 MB are served first
+	PRIORITY_AGING                = 2 * time.Minute // waiting task moves one lane up every period
+	MAX_CLIENT_QUEUED_TASKS       = 5               // queued tasks of a single client
+)
+
+var ErrClientQueueFull = errors.New("Too many of your repositories are in the queue, please wait for them")
+
+var priorityNames = map[Priority]string{
+	PRIORITY_HIGH:   "high",
+	PRIORITY_NORMAL: "normal",
+	PRIORITY_LOW:    "low",
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// Classify returns the lane of a request, authenticated tells
+// whether it is made by an API client and background whether the client
+// asked for a low priority, e.g. for a scheduled refresh
+func Classify(size int64, authenticated, background bool) Priority {
+	if background {
+		return PRIORITY_LOW
+	}
+
+	if authenticated || size <= SMALL_REPO_SIZE {
+		return PRIORITY_HIGH
+	}
+
+	return PRIORITY_NORMAL
+}
+
+// move the task to a higher lane, must be called with the queue mutex held
+func (this *RepoTask) raise(priority Priority) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.Priority = min(this.Priority, priority)
+}
+
+// QueueEntry describes a queued or running task for the admin endpoint
+type QueueEntry struct {
+	ID            string    `json:"id"`
+	Owner         string    `json:"owner"`
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"`
+	Client        string    `json:"client"`
+	Priority      string    `json:"priority"`
+	State         string    `json:"state"`
+	Position      int       `json:"position"` // 0 for running tasks
+	QueuedAt      time.Time `json:"queued_at"`
+	StartedAt     time.Time `json:"started_at"`     // zero for queued tasks
+	EstimatedWait float64   `json:"estimated_wait"` // seconds until the task is done
+}
+
+// lane of the task taking into account how long it waits,
+// must be called with the mutex held
+func (this *TaskQueue) lane(task *RepoTask, now time.Time) Priority {
+	promoted := Priority(now.Sub(task.queuedAt) / PRIORITY_AGING)
+
+	if promoted >= task.Priority {
+		return PRIORITY_HIGH
+	}
+
+	return task.Priority - promoted
+}
+
+// index of the task that is taken next: the highest lane first, then the client
+// with the fewest running tasks, then the earliest one, must be called with the mutex held
+func (this *TaskQueue) pick(pending []*RepoTask, clients map[string]int, now time.Time) int {
+	best := -1
+
+	for i, task := range pending {
+		if best == -1 {
+			best = i
+			continue
+		}
+
+		lane, bestLane := this.lane(task, now), this.lane(pending[best], now)
+
+		if lane < bestLane || lane == bestLane && clients[task.Client] < clients[pending[best].Client] {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// running tasks by client, must be called with the mutex held
+func (this *TaskQueue) runningByClient() map[string]int {
+	clients := make(map[string]int)
+
+	for task := range this.running {
+		clients[task.Client]++
+	}
+
+	return clients
+}
+
+// queued tasks in the order they will be taken, must be called with the mutex held
+func (this *TaskQueue) order() []*RepoTask {
+	now := time.Now()
+	pending := slices.Clone(this.pending)
+	clients := this.runningByClient()
+	ordered := make([]*RepoTask, 0, len(pending))
+
+	for len(pending) > 0 {
+		i := this.pick(pending, clients, now)
+		clients[pending[i].Client]++
+		ordered = append(ordered, pending[i])
+		pending = slices.Delete(pending, i, i+1)
+	}
+
+	return ordered
+}
+
+// number of queued tasks of the client, must be called with the mutex held
+func (this *TaskQueue) queuedByClient(client string) int {
+	count := 0
+
+	for _, task := range this.pending {
+		if task.Client == client {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Entries lists running tasks and queued ones in the order they will be taken
+func (this *TaskQueue) Entries() []QueueEntry {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	entries := make([]QueueEntry, 0, len(this.running)+len(this.pending))
+
+	for task, start := range this.running {
+		entries = append(entries, QueueEntry{
+			ID:            task.ID,
+			Owner:         task.Owner,
+			Name:          task.Name,
+			Size:          task.Size,
+			Client:        task.Client,
+			Priority:      task.Priority.String(),
+			State:         task.State().String(),
+			QueuedAt:      task.queuedAt,
+			StartedAt:     start,
+			EstimatedWait: max(this.estimate(task.Size)-time.Since(start), 0).Seconds(),
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b QueueEntry) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	ordered := this.order()
+
+	for i, task := range ordered {
+		free := this.schedule(ordered[:i])
+
+		entries = append(entries, QueueEntry{
+			ID:            task.ID,
+			Owner:         task.Owner,
+			Name:          task.Name,
+			Size:          task.Size,
+			Client:        task.Client,
+			Priority:      task.Priority.String(),
+			State:         task.State().String(),
+			Position:      i + 1,
+			QueuedAt:      task.queuedAt,
+			EstimatedWait: (slices.Min(free) + this.estimate(task.Size)).Seconds(),
+		})
+	}
+
+	return entries
+}
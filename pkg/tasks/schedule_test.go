@@ -0,0 +1,122 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/analyzer"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		size          int64
+		authenticated bool
+		background    bool
+		expected      Priority
+	}{
+		{100 << 20, false, false, PRIORITY_NORMAL},
+		{1 << 20, false, false, PRIORITY_HIGH},
+		{100 << 20, true, false, PRIORITY_HIGH},
+		{1 << 20, true, true, PRIORITY_LOW},
+	}
+
+	for _, test := range tests {
+		if priority := Classify(test.size, test.authenticated, test.background); priority != test.expected {
+			t.Errorf("Classify(%d, %v, %v) = %s, expected %s", test.size, test.authenticated, test.background, priority, test.expected)
+		}
+	}
+}
+
+func addTestTask(q *TaskQueue, client string, priority Priority) (*RepoTask, error) {
+	task := &RepoTask{
+		Owner:    client,
+		Name:     fmt.Sprintf("repo%d", len(q.pending)),
+		Client:   client,
+		Priority: priority,
+		Opts:     &analyzer.Options{},
+	}
+
+	_, err := q.Add(task)
+
+	return task, err
+}
+
+func names(tasks []*RepoTask) []string {
+	list := make([]string, 0, len(tasks))
+
+	for _, task := range tasks {
+		list = append(list, task.Owner+"/"+task.Name)
+	}
+
+	return list
+}
+
+func TestScheduleOrder(t *testing.T) {
+	q := newTestQueue()
+
+	// one client floods the queue before others
+	for range 3 {
+		addTestTask(q, "a", PRIORITY_NORMAL)
+	}
+
+	addTestTask(q, "b", PRIORITY_NORMAL)
+	addTestTask(q, "c", PRIORITY_LOW)
+	addTestTask(q, "d", PRIORITY_HIGH)
+
+	expected := "[d/repo5 a/repo0 b/repo3 a/repo1 a/repo2 c/repo4]"
+
+	if order := fmt.Sprint(names(q.order())); order != expected {
+		t.Errorf("Expected order %s, got %s", expected, order)
+	}
+
+	// the order is the one the workers take tasks in
+	for _, name := range []string{"d/repo5", "a/repo0", "b/repo3"} {
+		if task := q.next(); task.Owner+"/"+task.Name != name {
+			t.Errorf("Expected %s to be taken, got %s/%s", name, task.Owner, task.Name)
+		}
+	}
+
+	if info := q.Info(q.order()[0]); info.Position != 1 || info.Ahead != 0 {
+		t.Errorf("Expected the first task at position 1, got %+v", info)
+	}
+}
+
+func TestScheduleAging(t *testing.T) {
+	q := newTestQueue()
+
+	low, _ := addTestTask(q, "a", PRIORITY_LOW)
+	addTestTask(q, "b", PRIORITY_NORMAL)
+
+	q.mu.Lock()
+	low.queuedAt = time.Now().Add(-PRIORITY_AGING)
+	order := q.order()
+	q.mu.Unlock()
+
+	// waited long enough to share the normal lane, and it is earlier
+	if order[0] != low {
+		t.Errorf("Expected aged low priority task first, got %v", names(order))
+	}
+}
+
+func TestClientQueueLimit(t *testing.T) {
+	q := newTestQueue()
+
+	for range MAX_CLIENT_QUEUED_TASKS {
+		if _, err := addTestTask(q, "a", PRIORITY_NORMAL); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := addTestTask(q, "a", PRIORITY_NORMAL); !errors.Is(err, ErrClientQueueFull) {
+		t.Errorf("Expected ErrClientQueueFull, got %v", err)
+	}
+
+	if _, err := addTestTask(q, "b", PRIORITY_NORMAL); err != nil {
+		t.Errorf("Expected other clients to be queued, got %v", err)
+	}
+
+	if entries := q.Entries(); len(entries) != MAX_CLIENT_QUEUED_TASKS+1 || entries[0].Position != 1 {
+		t.Errorf("Unexpected queue entries %+v", entries)
+	}
+}
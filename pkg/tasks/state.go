@@ -0,0 +1,213 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/analyzer"
+	"slices"
+	"time"
+)
+
+// TaskState is a state of the repository task,
+// numeric values are sent to clients as the task status
+type TaskState uint8
+
+const (
+	STATE_QUEUED    TaskState = iota + 1 // waiting for a worker
+	STATE_FETCHING                       // cloning the repository
+	STATE_ANALYZING                      // analyzing the cloned repository
+	STATE_SUCCEEDED                      // result is ready
+	STATE_CANCELED                       // canceled by the client
+	STATE_FAILED                         // finished with an error
+	STATE_EXPIRED                        // canceled because the client stopped polling
+)
+
+var ErrInvalidTransition = errors.New("Invalid task state transition")
+
+var stateNames = map[TaskState]string{
+	STATE_QUEUED:    "queued",
+	STATE_FETCHING:  "fetching",
+	STATE_ANALYZING: "analyzing",
+	STATE_SUCCEEDED: "succeeded",
+	STATE_CANCELED:  "canceled",
+	STATE_FAILED:    "failed",
+	STATE_EXPIRED:   "expired",
+}
+
+// allowed transitions, finished states have none.
+// running tasks go back to the queue only when they are restored after restart
+var transitions = map[TaskState][]TaskState{
+	STATE_QUEUED:    {STATE_FETCHING, STATE_FAILED, STATE_CANCELED, STATE_EXPIRED},
+	STATE_FETCHING:  {STATE_QUEUED, STATE_ANALYZING, STATE_FAILED, STATE_CANCELED, STATE_EXPIRED},
+	STATE_ANALYZING: {STATE_QUEUED, STATE_SUCCEEDED, STATE_FAILED, STATE_CANCELED, STATE_EXPIRED},
+}
+
+func (s TaskState) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", s)
+}
+
+// Finished reports whether the state is final
+func (s TaskState) Finished() bool {
+	return s >= STATE_SUCCEEDED
+}
+
+// StateChange is a transition of the task recorded with its time
+type StateChange struct {
+	State TaskState `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// TaskSnapshot is a consistent copy of the task state,
+// it is safe to read while the task is processed
+type TaskSnapshot struct {
+	ID            string
+	State         TaskState
+	Size          int64
+	Owner         string
+	Name          string
+	URL           string
+	Ref           Ref
+	Private       bool
+	PublicOnly    bool
+	Client        string
+	Priority      Priority
+	Opts          *analyzer.Options
+	Languages     []analyzer.LanguageData
+	Result        *analyzer.Result // set only in STATE_SUCCEEDED, must not be modified
+	Err           error            // set in STATE_FAILED, STATE_CANCELED and STATE_EXPIRED
+	FetchSpeed    time.Duration
+	AnalysisSpeed time.Duration
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	History       []StateChange
+	Subscribers   []string
+	ReadOnly      bool // restored from the store, the task is finished and no longer in memory
+}
+
+func (this *TaskSnapshot) Finished() bool {
+	return this.State.Finished()
+}
+
+// GetURL is the clone URL of the repository, see RepoTask.GetURL
+func (this *TaskSnapshot) GetURL() string {
+	return repoURL(this.URL, this.Owner, this.Name)
+}
+
+// Snapshot returns a copy of the task state
+func (this *RepoTask) Snapshot() TaskSnapshot {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return TaskSnapshot{
+		ID:            this.ID,
+		State:         this.state,
+		Size:          this.Size,
+		Owner:         this.Owner,
+		Name:          this.Name,
+		URL:           this.URL,
+		Ref:           this.Ref,
+		Private:       this.Private,
+		PublicOnly:    this.PublicOnly,
+		Client:        this.Client,
+		Priority:      this.Priority,
+		Opts:          this.Opts,
+		Languages:     this.Languages,
+		Result:        this.result,
+		Err:           this.err,
+		FetchSpeed:    this.fetchSpeed,
+		AnalysisSpeed: this.analysisSpeed,
+		CreatedAt:     this.CreatedAt,
+		UpdatedAt:     this.updatedAt,
+		History:       slices.Clone(this.history),
+		Subscribers:   slices.Clone(this.subscribers),
+	}
+}
+
+// State returns the current state of the task
+func (this *RepoTask) State() TaskState {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return this.state
+}
+
+// must be called with the task lock held
+func (this *RepoTask) setState(state TaskState) {
+	now := time.Now()
+	this.state = state
+	this.updatedAt = now
+	this.history = append(this.history, StateChange{State: state, At: now})
+}
+
+// move the task to the state and persist it, apply is called under the lock
+// to set the outcome of the state. ErrInvalidTransition is returned if the state
+// can not be reached from the current one, e.g. the task is already finished
+func (this *RepoTask) transition(to TaskState, apply func()) error {
+	this.mu.Lock()
+
+	if !slices.Contains(transitions[this.state], to) {
+		from := this.state
+		this.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	if apply != nil {
+		apply()
+	}
+
+	this.setState(to)
+	this.mu.Unlock()
+
+	RepoTaskQueue.save(this)
+
+	return nil
+}
+
+// finish the task in the state with the error, the result is dropped
+func (this *RepoTask) fail(state TaskState, err error) error {
+	return this.transition(state, func() {
+		this.result = nil
+		this.err = err
+	})
+}
+
+func (this *RepoTask) subscribe(id string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.subscribers = append(this.subscribers, id)
+	this.updatedAt = time.Now()
+}
+
+// remove id from the subscribers of the unfinished task and return how many of them are left,
+// false is returned if the task is finished, its result is kept for all of them
+func (this *RepoTask) leave(id string) (int, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.state.Finished() {
+		return 0, false
+	}
+
+	this.subscribers = slices.DeleteFunc(this.subscribers, func(subscriber string) bool {
+		return subscriber == id
+	})
+
+	return len(this.subscribers), true
+}
+
+// remove id from the task subscribers and return how many of them are left
+func (this *RepoTask) unsubscribe(id string) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.subscribers = slices.DeleteFunc(this.subscribers, func(subscriber string) bool {
+		return subscriber == id
+	})
+
+	return len(this.subscribers)
+}
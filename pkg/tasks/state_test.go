@@ -0,0 +1,304 @@
+package tasks
+
+import (
+	"errors"
+	"git-analyzer/pkg/analyzer"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+func newTestQueue() *TaskQueue {
+	q := &TaskQueue{
+		workers:  1,
+		running:  make(map[*RepoTask]time.Time),
+		inflight: make(map[string]*RepoTask),
+		Cache:    ttlcache.New[string, *RepoTask](),
+	}
+
+	q.released = sync.NewCond(&q.mu)
+	q.queued = sync.NewCond(&q.mu)
+
+	return q
+}
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		path []TaskState
+		ok   bool
+	}{
+		{[]TaskState{STATE_FETCHING, STATE_ANALYZING, STATE_SUCCEEDED}, true},
+		{[]TaskState{STATE_FETCHING, STATE_FAILED}, true},
+		{[]TaskState{STATE_CANCELED}, true},
+		{[]TaskState{STATE_FETCHING, STATE_QUEUED, STATE_FETCHING}, true},
+		{[]TaskState{STATE_ANALYZING}, false},
+		{[]TaskState{STATE_SUCCEEDED}, false},
+		{[]TaskState{STATE_CANCELED, STATE_FETCHING}, false},
+		{[]TaskState{STATE_FETCHING, STATE_FAILED, STATE_SUCCEEDED}, false},
+		{[]TaskState{STATE_QUEUED}, false},
+	}
+
+	for _, test := range tests {
+		task := &RepoTask{}
+		task.setState(STATE_QUEUED)
+
+		var err error
+
+		for _, state := range test.path {
+			if err = task.transition(state, nil); err != nil {
+				break
+			}
+		}
+
+		if test.ok != (err == nil) {
+			t.Errorf("Path %v: expected ok %v, got error %v", test.path, test.ok, err)
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Path %v: expected ErrInvalidTransition, got %v", test.path, err)
+		}
+
+		if test.ok {
+			history := task.Snapshot().History
+
+			if len(history) != len(test.path)+1 {
+				t.Errorf("Path %v: expected %d history entries, got %d", test.path, len(test.path)+1, len(history))
+			}
+
+			for i := 1; i < len(history); i++ {
+				if history[i].At.Before(history[i-1].At) {
+					t.Errorf("Path %v: history is not ordered %v", test.path, history)
+				}
+			}
+		}
+	}
+}
+
+func TestSnapshotUnderConcurrentTransitions(t *testing.T) {
+	task := &RepoTask{ID: "task", Owner: "owner", Name: "name", Opts: &analyzer.Options{}}
+	task.setState(STATE_QUEUED)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		task.transition(STATE_FETCHING, nil)
+		task.transition(STATE_ANALYZING, func() { task.fetchSpeed = time.Second })
+		task.transition(STATE_SUCCEEDED, func() { task.result = &analyzer.Result{TotalLines: 10} })
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				snapshot := task.Snapshot()
+
+				// the outcome is set together with the final state
+				if snapshot.State == STATE_SUCCEEDED && snapshot.Result == nil {
+					t.Error("Succeeded task without result")
+				}
+
+				if _, err := EncodeTask(task); err != nil {
+					t.Error(err)
+				}
+
+				task.subscribe("subscriber")
+				task.unsubscribe("subscriber")
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	snapshot := task.Snapshot()
+
+	if snapshot.State != STATE_SUCCEEDED || snapshot.Result.TotalLines != 10 || snapshot.FetchSpeed != time.Second {
+		t.Errorf("Unexpected final snapshot %+v", snapshot)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	q := newTestQueue()
+
+	first, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	second, _ := q.Add(&RepoTask{Owner: "Owner", Name: "Name", Opts: &analyzer.Options{}})
+	task, _ := q.GetTask(first)
+
+	if shared, _ := q.GetTask(second); shared != task || len(q.pending) != 1 {
+		t.Fatalf("Expected identical requests to share the task")
+	}
+
+	// another request still waits for the task
+	if !q.Cancel(first) || task.State() != STATE_QUEUED {
+		t.Fatalf("Expected the task to stay queued, got %s", task.State())
+	}
+
+	if !q.Cancel(second) || task.State() != STATE_CANCELED || len(q.pending) != 0 {
+		t.Fatalf("Expected the task to be canceled, got %s", task.State())
+	}
+
+	if q.Cancel(second) {
+		t.Errorf("Expected finished task not to be canceled again")
+	}
+
+	expired, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	task, _ = q.GetTask(expired)
+
+	if task.State() != STATE_QUEUED {
+		t.Fatalf("Expected a new task after cancellation, got %s", task.State())
+	}
+
+	q.mu.Lock()
+	task.polledAt = time.Now().Add(-time.Hour)
+	q.mu.Unlock()
+
+	q.cancelAbandoned(time.Minute)
+
+	if snapshot := task.Snapshot(); snapshot.State != STATE_EXPIRED || !errors.Is(snapshot.Err, ErrTaskExpired) {
+		t.Errorf("Expected the task to expire, got %s %v", snapshot.State, snapshot.Err)
+	}
+}
+
+func TestRunningTaskCanceledWhileWaitingForSpace(t *testing.T) {
+	q := newTestQueue()
+	q.maxDiskSize = 500 << 20
+	q.MaxRepoSize = 300 << 20
+	q.freeMemory = 150 << 20
+	q.reserved = 250 << 20 // held by another repository
+
+	queue := RepoTaskQueue
+	RepoTaskQueue = q
+	defer func() { RepoTaskQueue = queue }()
+
+	id, _ := q.Add(&RepoTask{Size: 200 << 20, Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	task := q.next()
+
+	done := make(chan struct{})
+
+	go func() {
+		task.Process()
+		q.finish(task)
+		close(done)
+	}()
+
+	if !q.Cancel(id) {
+		t.Fatal("Expected running task to be canceled")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Task waiting for disk space was not canceled")
+	}
+
+	if snapshot := task.Snapshot(); snapshot.State != STATE_CANCELED || !errors.Is(snapshot.Err, ErrTaskCanceled) {
+		t.Errorf("Expected canceled task, got %s %v", snapshot.State, snapshot.Err)
+	}
+}
+
+func TestPrivateTaskCoalescing(t *testing.T) {
+	q := newTestQueue()
+
+	add := func(token string) *RepoTask {
+		task := &RepoTask{Owner: "owner", Name: "name", Private: true, Opts: &analyzer.Options{}}
+		task.UseToken("user", token)
+		id, _ := q.Add(task)
+		shared, _ := q.GetTask(id)
+
+		return shared
+	}
+
+	first := add("token")
+
+	if add("token") != first {
+		t.Errorf("Expected requests with the same token to share the task")
+	}
+
+	if add("other") == first {
+		t.Errorf("Expected requests with another token not to share the private task")
+	}
+
+	data, _ := EncodeTask(first)
+
+	if restored, err := DecodeTask(data); err != nil || restored.token != "" || !restored.Private {
+		t.Errorf("Expected the token not to be persisted, got %v", err)
+	}
+}
+
+func TestGetTaskLiveOnly(t *testing.T) {
+	store, err := NewDiskTaskStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := newTestQueue()
+	q.store = store
+
+	first, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	second, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	task, _ := q.GetTask(first)
+
+	// a queued task is live even if the cache forgot it
+	q.Cache.DeleteAll()
+
+	for _, id := range []string{first, second} {
+		if live, ok := q.GetTask(id); !ok || live != task {
+			t.Errorf("Expected the queued task by %s, got %v", id, ok)
+		}
+
+		if snapshot, ok := q.GetSnapshot(id); !ok || snapshot.ReadOnly {
+			t.Errorf("Expected the live snapshot by %s, got %v %v", id, ok, snapshot.ReadOnly)
+		}
+	}
+
+	running := q.next()
+	running.fail(STATE_FAILED, errors.New("failed"))
+	q.finish(running)
+	q.save(running)
+	q.Cache.DeleteAll()
+
+	// the finished task is in the store only, it is read but not live anymore
+	for _, id := range []string{first, second} {
+		if _, ok := q.GetTask(id); ok {
+			t.Errorf("Expected no live task by %s", id)
+		}
+
+		if snapshot, ok := q.GetSnapshot(id); !ok || !snapshot.ReadOnly || snapshot.State != STATE_FAILED {
+			t.Errorf("Expected the read-only snapshot by %s, got %v %+v", id, ok, snapshot)
+		}
+	}
+
+	q.DeleteTask(second)
+
+	if _, ok := q.GetSnapshot(second); ok {
+		t.Errorf("Expected the deleted request not to find the task")
+	}
+
+	if _, ok := q.GetSnapshot(first); !ok {
+		t.Errorf("Expected the task to be kept for the other request")
+	}
+
+	// unfinished tasks of the store are live in another queue, their copies are not returned
+	unfinished, _ := q.Add(&RepoTask{Owner: "other", Name: "name", Opts: &analyzer.Options{}})
+	q.Cache.DeleteAll()
+	q.inflight = make(map[string]*RepoTask)
+
+	if _, ok := q.GetSnapshot(unfinished); ok {
+		t.Errorf("Expected no snapshot of the unfinished stored task")
+	}
+}
@@ -0,0 +1,258 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git-analyzer/pkg/analyzer"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TASK_TTL = time.Hour // persisted tasks expire after the last update
+
+// TaskStore persists repository tasks, so queued and running tasks
+// survive restarts and results can be fetched after a redeploy
+type TaskStore interface {
+	Save(task *RepoTask) error // saves of the same task are not concurrent
+	Get(id string) (*RepoTask, bool)
+	Delete(id string) error
+	List() ([]*RepoTask, error) // all not expired tasks
+}
+
+// serialized form of RepoTask
+type storedTask struct {
+	ID            string                  `json:"id"`
+	State         TaskState               `json:"state"`
+	Size          int64                   `json:"size"`
+	Owner         string                  `json:"owner"`
+	Name          string                  `json:"name"`
+	URL           string                  `json:"url"`
+	Ref           Ref                     `json:"ref"`
+	Private       bool                    `json:"private"`
+	PublicOnly    bool                    `json:"public_only"`
+	Client        string                  `json:"client"`
+	Priority      Priority                `json:"priority"`
+	Opts          *analyzer.Options       `json:"opts"`
+	Languages     []analyzer.LanguageData `json:"languages"`
+	Result        *analyzer.Result        `json:"result"`
+	FetchSpeed    time.Duration           `json:"fetch_speed"`
+	AnalysisSpeed time.Duration           `json:"analysis_speed"`
+	Error         string                  `json:"error"`
+	ErrorCode     ErrorCode               `json:"error_code"`
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+	Subscribers   []string                `json:"subscribers"`
+	History       []StateChange           `json:"history"`
+}
+
+// EncodeTask serializes task for a TaskStore
+func EncodeTask(task *RepoTask) ([]byte, error) {
+	snapshot := task.Snapshot()
+	stored := &storedTask{
+		ID:            snapshot.ID,
+		State:         snapshot.State,
+		Size:          snapshot.Size,
+		Owner:         snapshot.Owner,
+		Name:          snapshot.Name,
+		URL:           snapshot.URL,
+		Ref:           snapshot.Ref,
+		Private:       snapshot.Private,
+		PublicOnly:    snapshot.PublicOnly,
+		Client:        snapshot.Client,
+		Priority:      snapshot.Priority,
+		Opts:          snapshot.Opts,
+		Languages:     snapshot.Languages,
+		Result:        snapshot.Result,
+		FetchSpeed:    snapshot.FetchSpeed,
+		AnalysisSpeed: snapshot.AnalysisSpeed,
+		CreatedAt:     snapshot.CreatedAt,
+		UpdatedAt:     snapshot.UpdatedAt,
+		Subscribers:   snapshot.Subscribers,
+		History:       snapshot.History,
+	}
+
+	if snapshot.Err != nil {
+		stored.Error = snapshot.Err.Error()
+		stored.ErrorCode = ErrorCodeOf(snapshot.Err)
+	}
+
+	return json.Marshal(stored)
+}
+
+// DecodeTask restores task serialized by EncodeTask
+func DecodeTask(data []byte) (*RepoTask, error) {
+	stored := &storedTask{}
+
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil, err
+	}
+
+	if _, ok := stateNames[stored.State]; !ok {
+		return nil, fmt.Errorf("Unknown task state %d", stored.State)
+	}
+
+	task := &RepoTask{
+		ID:            stored.ID,
+		Size:          stored.Size,
+		Owner:         stored.Owner,
+		Name:          stored.Name,
+		URL:           stored.URL,
+		Ref:           stored.Ref,
+		Private:       stored.Private,
+		PublicOnly:    stored.PublicOnly,
+		Client:        stored.Client,
+		Priority:      stored.Priority,
+		Opts:          stored.Opts,
+		Languages:     stored.Languages,
+		CreatedAt:     stored.CreatedAt,
+		state:         stored.State,
+		result:        stored.Result,
+		fetchSpeed:    stored.FetchSpeed,
+		analysisSpeed: stored.AnalysisSpeed,
+		updatedAt:     stored.UpdatedAt,
+		subscribers:   stored.Subscribers,
+		history:       stored.History,
+	}
+
+	if stored.Error != "" {
+		task.err = newTaskError(stored.ErrorCode, errors.New(stored.Error))
+	}
+
+	if task.Opts == nil {
+		task.Opts = &analyzer.Options{}
+	}
+
+	// registry is not serialized, it is rebuilt from the request languages
+	if len(task.Languages) > 0 {
+		registry, err := analyzer.DefaultRegistry().Extend(task.Languages)
+
+		if err != nil {
+			return nil, err
+		}
+
+		task.Opts.Registry = registry
+	}
+
+	return task, nil
+}
+
+// SortTasks sorts tasks in the order they were created
+func SortTasks(tasks []*RepoTask) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+}
+
+// DiskTaskStore keeps every task in a separate JSON file,
+// it is used when Redis is not configured
+type DiskTaskStore struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+}
+
+func NewDiskTaskStore(dir string) (*DiskTaskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DiskTaskStore{dir: dir, ttl: TASK_TTL}, nil
+}
+
+func (d *DiskTaskStore) path(id string) string {
+	return filepath.Join(d.dir, id+".json")
+}
+
+func (d *DiskTaskStore) Save(task *RepoTask) error {
+	data, err := EncodeTask(task)
+
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// write to a temporary file first, so a crash never leaves a broken task
+	tmp := d.path(task.ID) + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, d.path(task.ID))
+}
+
+func (d *DiskTaskStore) Get(id string) (*RepoTask, bool) {
+	// ids come from requests, they must not escape the store directory
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.read(d.path(id))
+}
+
+// reads task removing it if it is expired or broken
+func (d *DiskTaskStore) read(path string) (*RepoTask, bool) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, false
+	}
+
+	task, err := DecodeTask(data)
+
+	if err != nil || time.Since(task.Snapshot().UpdatedAt) > d.ttl {
+		os.Remove(path)
+		return nil, false
+	}
+
+	return task, true
+}
+
+func (d *DiskTaskStore) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := os.Remove(d.path(id))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *DiskTaskStore) List() ([]*RepoTask, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*RepoTask, 0, len(paths))
+
+	for _, path := range paths {
+		if task, ok := d.read(path); ok {
+			tasks = append(tasks, task)
+		} else {
+			log.Printf("Dropped expired or broken task %s", filepath.Base(path))
+		}
+	}
+
+	SortTasks(tasks)
+
+	return tasks, nil
+}
@@ -0,0 +1,308 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git-analyzer/pkg/analyzer"
+)
+
+// task with the given state as it is left by a worker
+func newStoredTask(id string, private bool, path ...TaskState) *RepoTask {
+	task := &RepoTask{
+		ID:         id,
+		Size:       1 << 20,
+		Owner:      "owner",
+		Name:       id,
+		URL:        "https://example.com/owner/" + id,
+		Ref:        Ref{Name: "main", Reference: "refs/heads/main", Commit: "0123456789abcdef0123456789abcdef01234567"},
+		Private:    private,
+		PublicOnly: true,
+		Client:     "client",
+		Priority:   PRIORITY_HIGH,
+		Opts:       &analyzer.Options{},
+		CreatedAt:  time.Now(),
+	}
+
+	task.subscribers = []string{id, id + "-other"}
+	task.setState(STATE_QUEUED)
+
+	for _, state := range path {
+		switch state {
+		case STATE_SUCCEEDED:
+			task.transition(state, func() { task.result = &analyzer.Result{TotalFiles: 3, TotalLines: 42} })
+		case STATE_FAILED:
+			task.fail(state, newTaskError(ERROR_NOT_FOUND, errors.New("Repository not found")))
+		default:
+			task.transition(state, nil)
+		}
+	}
+
+	return task
+}
+
+func TestEncodeTask(t *testing.T) {
+	tests := []struct {
+		name string
+		path []TaskState
+	}{
+		{"queued", nil},
+		{"running", []TaskState{STATE_FETCHING, STATE_ANALYZING}},
+		{"succeeded", []TaskState{STATE_FETCHING, STATE_ANALYZING, STATE_SUCCEEDED}},
+		{"failed", []TaskState{STATE_FETCHING, STATE_FAILED}},
+	}
+
+	for _, test := range tests {
+		task := newStoredTask(test.name, false, test.path...)
+		data, err := EncodeTask(task)
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+
+		restored, err := DecodeTask(data)
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+
+		expected, actual := task.Snapshot(), restored.Snapshot()
+
+		if expected.Err != nil {
+			if actual.Err == nil || actual.Err.Error() != expected.Err.Error() || ErrorCodeOf(actual.Err) != ErrorCodeOf(expected.Err) {
+				t.Errorf("%s: expected error %v, got %v", test.name, expected.Err, actual.Err)
+			}
+		} else if actual.Err != nil {
+			t.Errorf("%s: unexpected restored error %v", test.name, actual.Err)
+		}
+
+		if !actual.CreatedAt.Equal(expected.CreatedAt) || !actual.UpdatedAt.Equal(expected.UpdatedAt) {
+			t.Errorf("%s: expected times %v %v, got %v %v", test.name, expected.CreatedAt, expected.UpdatedAt, actual.CreatedAt, actual.UpdatedAt)
+		}
+
+		for i := range expected.History {
+			if i >= len(actual.History) || !actual.History[i].At.Equal(expected.History[i].At) {
+				t.Errorf("%s: expected history %v, got %v", test.name, expected.History, actual.History)
+				break
+			}
+
+			expected.History[i].At = actual.History[i].At
+		}
+
+		// errors lose their type, times their monotonic clock and location
+		expected.Err, actual.Err = nil, nil
+		expected.CreatedAt, expected.UpdatedAt = actual.CreatedAt, actual.UpdatedAt
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, expected, actual)
+		}
+	}
+
+	if _, err := DecodeTask([]byte(`{"state": 100}`)); err == nil {
+		t.Errorf("Expected an unknown state not to be decoded")
+	}
+}
+
+func TestDiskTaskStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskTaskStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := newStoredTask("old", false)
+	task := newStoredTask("task", false)
+	old.CreatedAt = task.CreatedAt.Add(-time.Minute)
+
+	for _, task := range []*RepoTask{task, old} {
+		if err := store.Save(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// broken files are dropped instead of failing the whole store
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644)
+
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"task", true},
+		{"old", true},
+		{"missing", false},
+		{"broken", false},
+		{"../task", false},
+	}
+
+	for _, test := range tests {
+		if _, ok := store.Get(test.id); ok != test.ok {
+			t.Errorf("Get(%q): expected %v, got %v", test.id, test.ok, ok)
+		}
+	}
+
+	list, err := store.List()
+
+	if err != nil || len(list) != 2 || list[0].ID != "old" || list[1].ID != "task" {
+		t.Errorf("Expected the tasks in the order they were created, got %v %v", list, err)
+	}
+
+	store.Delete("old")
+
+	if err := store.Delete("old"); err != nil {
+		t.Errorf("Expected deleting a missing task to succeed, got %v", err)
+	}
+
+	// tasks not updated within the ttl expire
+	store.ttl = 0
+
+	if list, _ := store.List(); len(list) != 0 {
+		t.Errorf("Expected expired tasks to be dropped, got %d", len(list))
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("Expected expired and broken files to be removed, got %v", files)
+	}
+}
+
+func TestUseStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskTaskStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       string
+		private  bool
+		path     []TaskState
+		expected TaskState
+		queued   bool
+	}{
+		{"queued", false, nil, STATE_QUEUED, true},
+		{"fetching", false, []TaskState{STATE_FETCHING}, STATE_QUEUED, true},
+		{"analyzing", false, []TaskState{STATE_FETCHING, STATE_ANALYZING}, STATE_QUEUED, true},
+		{"succeeded", false, []TaskState{STATE_FETCHING, STATE_ANALYZING, STATE_SUCCEEDED}, STATE_SUCCEEDED, false},
+		{"failed", false, []TaskState{STATE_FETCHING, STATE_FAILED}, STATE_FAILED, false},
+		// the token is not persisted, the private task can not be cloned again
+		{"private", true, []TaskState{STATE_FETCHING}, STATE_FAILED, false},
+	}
+
+	for _, test := range tests {
+		if err := store.Save(newStoredTask(test.id, test.private, test.path...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the store is opened again the way it is on boot
+	store, _ = NewDiskTaskStore(dir)
+	q := newTestQueue()
+
+	if err := q.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		for _, id := range []string{test.id, test.id + "-other"} {
+			item := q.Cache.Get(id)
+
+			if item == nil {
+				t.Errorf("%s: expected the task to be restored by %s", test.id, id)
+				continue
+			}
+
+			snapshot := item.Value().Snapshot()
+
+			if snapshot.State != test.expected {
+				t.Errorf("%s: expected %s, got %s", test.id, test.expected, snapshot.State)
+			}
+
+			if test.private && ErrorCodeOf(snapshot.Err) != ERROR_AUTH {
+				t.Errorf("%s: expected %s error code, got %v", test.id, ERROR_AUTH, snapshot.Err)
+			}
+
+			if queued := slices.Contains(q.pending, item.Value()); queued != test.queued {
+				t.Errorf("%s: expected queued %v, got %v", test.id, test.queued, queued)
+			}
+		}
+	}
+
+	// re-queued tasks are coalesced with new identical requests
+	id, _ := q.Add(&RepoTask{Owner: "owner", Name: "queued", URL: "https://example.com/owner/queued", Ref: Ref{Name: "main", Reference: "refs/heads/main", Commit: "0123456789abcdef0123456789abcdef01234567"}, Opts: &analyzer.Options{}})
+
+	if task, _ := q.GetTask(id); task == nil || task.ID != "queued" {
+		t.Errorf("Expected the new request to share the restored task, got %v", task)
+	}
+}
+
+// store holding the first save until it is released
+type blockingStore struct {
+	*DiskTaskStore
+	blocked  chan struct{}
+	released chan struct{}
+	held     atomic.Bool
+}
+
+func (s *blockingStore) Save(task *RepoTask) error {
+	data, err := EncodeTask(task)
+
+	if err != nil {
+		return err
+	}
+
+	// later saves are not held, they are written as soon as they are made
+	if s.held.CompareAndSwap(false, true) {
+		close(s.blocked)
+		<-s.released
+	}
+
+	decoded, _ := DecodeTask(data)
+
+	return s.DiskTaskStore.Save(decoded)
+}
+
+func TestSaveOrder(t *testing.T) {
+	disk, err := NewDiskTaskStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &blockingStore{DiskTaskStore: disk, blocked: make(chan struct{}), released: make(chan struct{})}
+	q := newTestQueue()
+
+	queue := RepoTaskQueue
+	RepoTaskQueue = q
+	defer func() { RepoTaskQueue = queue }()
+
+	id, _ := q.Add(&RepoTask{Owner: "owner", Name: "name", Opts: &analyzer.Options{}})
+	task, _ := q.GetTask(id)
+	q.store = store
+
+	// the queued state is taken and its write is held
+	go q.save(task)
+	<-store.blocked
+
+	done := make(chan struct{})
+
+	go func() {
+		task.transition(STATE_FETCHING, nil)
+		task.fail(STATE_FAILED, errors.New("failed"))
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(store.released)
+	<-done
+
+	if stored, ok := disk.Get(task.ID); !ok || stored.State() != STATE_FAILED {
+		t.Errorf("Expected the failed task to be stored last, got %v", ok)
+	}
+}